@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rusvr/socket"
+)
+
+func main() {
+	// 修改peers.json后发送SIGHUP重新加载
+	reloader := socket.NewConfigReloader("peers.json")
+	reloader.SetApplyToExisting(true)
+
+	peers, err := reloader.Load()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	reloader.WatchSignal()
+
+	// 管理接口, 如 curl 127.0.0.1:8899/sessions
+	// 可以断开会话和重新加载配置, 只监听本机地址, 设置ADMIN_TOKEN时需要带 Authorization: Bearer <token>
+	admin := socket.NewAdminConsole()
+	admin.SetReloader(reloader)
+
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		admin.SetAuth(socket.AdminTokenAuth(token))
+	}
+
+	for _, p := range peers {
+		admin.AddPeer(p)
+	}
+
+	if err := admin.Start("127.0.0.1:8899"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	// connector在后台连接, acceptor在当前线程接受连接, 放在最后启动
+	for index := len(peers) - 1; index >= 0; index-- {
+		p := peers[index]
+
+		fmt.Println(p.(interface {
+			ChainString() string
+		}).ChainString())
+
+		if index == 0 {
+			p.Start(p.Address())
+		} else {
+			go p.Start(p.Address())
+		}
+	}
+}
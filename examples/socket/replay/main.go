@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rusvr/socket"
+)
+
+const captureFile = "replay.rscp"
+
+// 记录器放在封包读取之后, 封包写入之前, 记录的是完整的封包内容
+func recordedChain(capture *socket.CaptureFile) (read, write func() *socket.HandlerChain) {
+	read = func() *socket.HandlerChain {
+		return socket.NewHandlerChain(socket.NewLengthFrameReader(), capture.NewRecorder())
+	}
+
+	write = func() *socket.HandlerChain {
+		return socket.NewHandlerChain(capture.NewRecorder(), socket.NewLengthFrameWriter())
+	}
+
+	return
+}
+
+func frameChain(p socket.Peer) {
+	p.SetReadWriteChain(func() *socket.HandlerChain {
+		return socket.NewHandlerChain(socket.NewLengthFrameReader())
+	}, func() *socket.HandlerChain {
+		return socket.NewHandlerChain(socket.NewLengthFrameWriter())
+	})
+}
+
+// 录制: 客户端发送几条消息, 服务器原样返回
+func record() error {
+	capture, err := socket.CreateCaptureFile(captureFile)
+	if err != nil {
+		return err
+	}
+
+	defer capture.Close()
+
+	server := socket.NewAcceptor()
+	server.SetName("server")
+	server.SetReadWriteChain(recordedChain(capture))
+	server.AddChainRecv(socket.NewHandlerChain(socket.NewMiddleware("echo", func(ev *socket.Event, next func()) {
+		if ev.Type == socket.Event_Recv {
+			ev.Ses.Send(append([]byte(nil), ev.Data...))
+		}
+
+		next()
+	})))
+
+	go server.Start("127.0.0.1:8802")
+	defer server.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connected := make(chan socket.Session, 1)
+
+	client := socket.NewConnector()
+	frameChain(client)
+	client.AddChainRecv(socket.NewHandlerChain(socket.NewMiddleware("client", func(ev *socket.Event, next func()) {
+		if ev.Type == socket.Event_Connected {
+			connected <- ev.Ses
+		}
+
+		next()
+	})))
+
+	client.Start("127.0.0.1:8802")
+	defer client.Stop()
+
+	ses := <-connected
+
+	for i := 1; i <= 3; i++ {
+		ev := socket.NewEvent(socket.Event_Send, ses)
+		ev.MsgID = uint32(i)
+		ev.Data = []byte(fmt.Sprintf("hello %d", i))
+		ses.Send(ev)
+
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// 重放: 将录制的客户端消息送入新的服务器处理链
+func replay() error {
+	reader, err := socket.OpenCaptureFile(captureFile)
+	if err != nil {
+		return err
+	}
+
+	for {
+		rec, err := reader.Next()
+		if err != nil {
+			break
+		}
+
+		fmt.Println(rec)
+	}
+
+	reader.Close()
+
+	replayer, err := socket.NewCaptureReplayer(captureFile, 0)
+	if err != nil {
+		return err
+	}
+
+	replayer.SetSpeed(2)
+
+	server := socket.NewAcceptor()
+	server.SetName("replay")
+	frameChain(server)
+	server.AddChainRecv(socket.NewHandlerChain(socket.NewMiddleware("print", func(ev *socket.Event, next func()) {
+		switch ev.Type {
+		case socket.Event_Accepted, socket.Event_Closed:
+			fmt.Println("replay:", ev.Type)
+		case socket.Event_Recv:
+			fmt.Printf("replay: msgid: %d %s\n", ev.MsgID, ev.Data)
+		}
+
+		next()
+	})))
+
+	return replayer.ReplayToPeer(server, frameChain)
+}
+
+func main() {
+	if err := record(); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	if err := replay(); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
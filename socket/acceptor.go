@@ -3,12 +3,85 @@ package socket
 import (
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 )
 
+// Acceptor 接受器, 可由Peer转换
+type Acceptor interface {
+	// 每个IP每秒允许新建的连接数, 超过时直接断开, 0表示不限制
+	// burst为允许的突发量, 0表示与每秒数量相同
+	SetConnectionRateLimit(perSec float64, burst int)
+
+	// 添加连接准入检查, 按添加顺序在创建Session之前执行
+	AddAdmissionHook(hook AdmissionHook)
+
+	// 被拒绝的连接数量
+	RejectedCount() int64
+
+	// 开启后, 连接必须先发送PROXY协议v1或v2头, 会话使用头中的真实客户端地址
+	SetProxyProtocol(enable bool)
+}
+
 type socketAcceptor struct {
 	*socketPeer
 
 	listener net.Listener
+
+	// 按IP限制新建连接, 为nil表示不限制
+	connRateLimit      *ipRateLimiter
+	connRateLimitGuard sync.RWMutex
+
+	// 准入检查
+	admission admissionChain
+
+	rejectedCount int64
+
+	proxyProtocol int32
+}
+
+func (acceptor *socketAcceptor) SetProxyProtocol(enable bool) {
+	var v int32
+	if enable {
+		v = 1
+	}
+
+	atomic.StoreInt32(&acceptor.proxyProtocol, v)
+}
+
+func (acceptor *socketAcceptor) AddAdmissionHook(hook AdmissionHook) {
+	acceptor.admission.Add(hook)
+}
+
+func (acceptor *socketAcceptor) RejectedCount() int64 {
+	return atomic.LoadInt64(&acceptor.rejectedCount)
+}
+
+func (acceptor *socketAcceptor) SetConnectionRateLimit(perSec float64, burst int) {
+	acceptor.connRateLimitGuard.Lock()
+
+	// 限速不变时保留每个IP的令牌桶, 如重新加载配置时
+	if perSec > 0 {
+		if limiter := acceptor.connRateLimit; limiter == nil || limiter.rate != perSec || limiter.burst != burst {
+			acceptor.connRateLimit = newIPRateLimiter(perSec, burst)
+		}
+	} else {
+		acceptor.connRateLimit = nil
+	}
+
+	acceptor.connRateLimitGuard.Unlock()
+}
+
+func (acceptor *socketAcceptor) allowConnection(conn net.Conn) bool {
+	acceptor.connRateLimitGuard.RLock()
+	limiter := acceptor.connRateLimit
+	acceptor.connRateLimitGuard.RUnlock()
+
+	if limiter == nil {
+		return true
+	}
+
+	return limiter.allow(conn.RemoteAddr())
 }
 
 func (acceptor *socketAcceptor) Start(address string) Peer {
@@ -41,14 +114,49 @@ func (acceptor *socketAcceptor) accept() {
 
 func (acceptor *socketAcceptor) onAccepted(conn net.Conn) {
 	fmt.Println("onAccepted")
+
+	// 解析PROXY协议头, 之后的准入检查使用真实客户端地址
+	if atomic.LoadInt32(&acceptor.proxyProtocol) != 0 {
+		proxied, err := readProxyHeader(conn)
+		if err != nil {
+			atomic.AddInt64(&acceptor.rejectedCount, 1)
+			fmt.Println("proxy protocol:", conn.RemoteAddr(), err.Error())
+			conn.Close()
+			return
+		}
+
+		conn = proxied
+	}
+
+	// 超过IP连接速度限制或准入检查不通过, 直接断开, 不进入会话管理
+	var admitted []AdmissionHook
+
+	ok := acceptor.allowConnection(conn)
+	if ok {
+		admitted, ok = acceptor.admission.Admit(conn)
+	}
+
+	if !ok {
+		atomic.AddInt64(&acceptor.rejectedCount, 1)
+		fmt.Println("connection rejected:", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
 	ses := newSession(conn, acceptor)
 
 	// 添加到管理器
 	acceptor.Add(ses)
 
 	// 断开后从管理器移除
-	ses.OnClose = func() {
+	ses.OnClose = func(reason CloseReason) {
 		acceptor.Remove(ses)
+		releaseAdmission(admitted, conn)
+	}
+
+	// 投递连接接受事件, 失败时关闭连接, 由收发线程完成清理
+	if !ses.postSystemEvent(Event_Accepted) {
+		ses.conn.Close()
 	}
 
 	// 事件处理完成开始处理数据收发
@@ -0,0 +1,329 @@
+package socket
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// AdminConsole 运行时查看和管理Peer的HTTP接口, 输出文本, 可以直接使用curl
+//
+//	GET  /peers                       Peer列表和处理链
+//	GET  /sessions?peer=name          会话列表, 不指定peer时列出所有
+//	GET  /events                      事件数量
+//	POST /kick?peer=name&id=1         断开会话
+//	POST /handlerlog?enable=1         开关处理器日志
+//	POST /msglog?mode=allow&ids=1,2   设置消息日志, mode为off, all, allow, deny
+//	POST /reload                      重新加载配置, 需要SetReloader
+//
+// 注意: 默认没有认证, 能访问地址的任何人都可以断开会话, 重新加载配置和开启日志
+// 只能监听127.0.0.1或内网地址, 需要从其他地址访问时使用SetAuth, 如SetAuth(AdminTokenAuth(token))
+type AdminConsole struct {
+	peers      []Peer
+	peersGuard sync.RWMutex
+
+	reloader *ConfigReloader
+
+	auth AdminAuthFunc
+
+	mux *http.ServeMux
+}
+
+// AdminAuthFunc 检查请求是否允许访问管理接口
+type AdminAuthFunc func(r *http.Request) bool
+
+// AdminTokenAuth 请求头需要带有 Authorization: Bearer <token>
+func AdminTokenAuth(token string) AdminAuthFunc {
+	want := []byte("Bearer " + token)
+
+	return func(r *http.Request) bool {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) == 1
+	}
+}
+
+// SetAuth 设置认证, 所有接口都需要通过认证, 在Start前调用
+func (self *AdminConsole) SetAuth(auth AdminAuthFunc) {
+	self.auth = auth
+}
+
+// AddPeer 添加需要管理的Peer
+func (self *AdminConsole) AddPeer(p Peer) {
+	self.peersGuard.Lock()
+	self.peers = append(self.peers, p)
+	self.peersGuard.Unlock()
+}
+
+// SetReloader 设置后可以通过/reload重新加载配置, 在Start前调用
+func (self *AdminConsole) SetReloader(reloader *ConfigReloader) {
+	self.reloader = reloader
+}
+
+func (self *AdminConsole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if self.auth != nil && !self.auth(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	self.mux.ServeHTTP(w, r)
+}
+
+// Start 在address上开启HTTP服务, 不阻塞
+// 没有设置认证时应该只监听本机或内网地址, 监听非本机地址时输出警告
+func (self *AdminConsole) Start(address string) error {
+	srv := &http.Server{Addr: address, Handler: self}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	if self.auth == nil && !isLoopbackAddr(ln.Addr()) {
+		fmt.Printf("admin console: listening on %s without auth, anyone who can reach it can kick sessions and reload config\n", ln.Addr())
+	}
+
+	go srv.Serve(ln)
+
+	return nil
+}
+
+func isLoopbackAddr(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && tcpAddr.IP.IsLoopback()
+}
+
+func (self *AdminConsole) peerList() []Peer {
+	self.peersGuard.RLock()
+	defer self.peersGuard.RUnlock()
+
+	return append([]Peer(nil), self.peers...)
+}
+
+// 按名字或地址查找Peer
+func (self *AdminConsole) findPeer(name string) Peer {
+	for _, p := range self.peerList() {
+		if p.Name() == name || p.Address() == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func peerType(p Peer) string {
+	switch p.(type) {
+	case Acceptor:
+		return "acceptor"
+	case Connector:
+		return "connector"
+	}
+
+	return "unknown"
+}
+
+func (self *AdminConsole) handlePeers(w http.ResponseWriter, r *http.Request) {
+	for _, p := range self.peerList() {
+		fmt.Fprintf(w, "%s %s %s sessions: %d\n", peerType(p), p.Name(), p.Address(), p.SessionCount())
+
+		if cs, ok := p.(interface {
+			ChainString() string
+		}); ok {
+			fmt.Fprintln(w, cs.ChainString())
+		}
+	}
+}
+
+func (self *AdminConsole) handleSessions(w http.ResponseWriter, r *http.Request) {
+	list := self.peerList()
+
+	if name := r.FormValue("peer"); name != "" {
+		p := self.findPeer(name)
+		if p == nil {
+			http.Error(w, "peer not found: "+name, http.StatusNotFound)
+			return
+		}
+
+		list = []Peer{p}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "peer\tid\tremote\tage\tqueue\tqueue bytes\tbytes in\tbytes out\tmsgs in\tmsgs out")
+
+	now := time.Now()
+
+	for _, p := range list {
+		var sesList []Session
+
+		p.VisitSession(func(ses Session) bool {
+			sesList = append(sesList, ses)
+			return true
+		})
+
+		sort.Slice(sesList, func(i, j int) bool {
+			return sesList[i].ID() < sesList[j].ID()
+		})
+
+		for _, ses := range sesList {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n",
+				p.Name(),
+				ses.ID(),
+				ses.RemoteAddr(),
+				now.Sub(ses.ConnectedAt()).Truncate(time.Second),
+				ses.SendQueueLen(),
+				ses.SendQueueSize(),
+				ses.BytesIn(),
+				ses.BytesOut(),
+				ses.MsgsIn(),
+				ses.MsgsOut(),
+			)
+		}
+	}
+
+	tw.Flush()
+}
+
+func (self *AdminConsole) handleEvents(w http.ResponseWriter, r *http.Request) {
+	for t := Event_Connected; t <= Event_Send; t++ {
+		fmt.Fprintf(w, "%s: %d\n", t, EventCount(t))
+	}
+}
+
+func (self *AdminConsole) handleKick(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	p := self.findPeer(r.FormValue("peer"))
+	if p == nil {
+		http.Error(w, "peer not found: "+r.FormValue("peer"), http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id: "+r.FormValue("id"), http.StatusBadRequest)
+		return
+	}
+
+	ses := p.GetSession(id)
+	if ses == nil {
+		http.Error(w, fmt.Sprintf("session not found: %d", id), http.StatusNotFound)
+		return
+	}
+
+	ses.Close()
+
+	fmt.Fprintf(w, "session %d closed\n", id)
+}
+
+func (self *AdminConsole) handleHandlerLog(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	enable, err := strconv.ParseBool(r.FormValue("enable"))
+	if err != nil {
+		http.Error(w, "invalid enable: "+r.FormValue("enable"), http.StatusBadRequest)
+		return
+	}
+
+	SetHandlerLog(enable)
+
+	fmt.Fprintf(w, "handler log: %v\n", enable)
+}
+
+func (self *AdminConsole) handleMsgLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		mode, ids := MsgLogSetting()
+		fmt.Fprintf(w, "msg log: %s %v\n", mode, ids)
+		return
+	}
+
+	if !requirePost(w, r) {
+		return
+	}
+
+	mode, err := parseMsgLogMode(r.FormValue("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ids []uint32
+
+	if s := r.FormValue("ids"); s != "" {
+		for _, str := range strings.Split(s, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(str), 10, 32)
+			if err != nil {
+				http.Error(w, "invalid msgid: "+str, http.StatusBadRequest)
+				return
+			}
+
+			ids = append(ids, uint32(id))
+		}
+	}
+
+	SetMsgLog(mode, ids...)
+
+	fmt.Fprintf(w, "msg log: %s %v\n", mode, ids)
+}
+
+func (self *AdminConsole) handleReload(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+
+	if self.reloader == nil {
+		http.Error(w, "reloader not set", http.StatusNotFound)
+		return
+	}
+
+	if err := self.reloader.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "reloaded")
+}
+
+func parseMsgLogMode(s string) (MsgLogMode, error) {
+	for _, mode := range []MsgLogMode{MsgLog_Off, MsgLog_All, MsgLog_Allow, MsgLog_Deny} {
+		if s == mode.String() {
+			return mode, nil
+		}
+	}
+
+	return MsgLog_Off, fmt.Errorf("unknown msg log mode: %s", s)
+}
+
+// 修改状态的操作只接受POST
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	return true
+}
+
+func NewAdminConsole() *AdminConsole {
+	self := &AdminConsole{
+		mux: http.NewServeMux(),
+	}
+
+	self.mux.HandleFunc("/peers", self.handlePeers)
+	self.mux.HandleFunc("/sessions", self.handleSessions)
+	self.mux.HandleFunc("/events", self.handleEvents)
+	self.mux.HandleFunc("/kick", self.handleKick)
+	self.mux.HandleFunc("/handlerlog", self.handleHandlerLog)
+	self.mux.HandleFunc("/msglog", self.handleMsgLog)
+	self.mux.HandleFunc("/reload", self.handleReload)
+
+	return self
+}
@@ -0,0 +1,120 @@
+package socket
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func adminRequest(admin *AdminConsole, method, target, auth string) int {
+	r := httptest.NewRequest(method, target, nil)
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+
+	return w.Code
+}
+
+func TestAdminAuth(t *testing.T) {
+	admin := NewAdminConsole()
+
+	if code := adminRequest(admin, http.MethodGet, "/events", ""); code != http.StatusOK {
+		t.Fatalf("without auth: %d", code)
+	}
+
+	admin.SetAuth(AdminTokenAuth("secret"))
+
+	tests := []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		if code := adminRequest(admin, http.MethodGet, "/events", tc.auth); code != tc.code {
+			t.Fatalf("auth %q: got %d, want %d", tc.auth, code, tc.code)
+		}
+	}
+
+	// 修改状态的接口同样需要认证
+	if code := adminRequest(admin, http.MethodPost, "/handlerlog?enable=1", ""); code != http.StatusUnauthorized || HandlerLogEnabled() {
+		t.Fatalf("handler log enabled without auth: %d", code)
+	}
+}
+
+func TestAdminMsgLog(t *testing.T) {
+	defer SetMsgLog(MsgLog_Off)
+
+	admin := NewAdminConsole()
+
+	if code := adminRequest(admin, http.MethodGet, "/msglog?mode=all", ""); code != http.StatusOK || msgLogEnabled(1) {
+		t.Fatalf("msg log changed by GET: %d", code)
+	}
+
+	tests := []struct {
+		query   string
+		mode    MsgLogMode
+		ids     string
+		logged  []uint32
+		skipped []uint32
+	}{
+		{"mode=all", MsgLog_All, "[]", []uint32{1, 2}, nil},
+		{"mode=allow&ids=1,3", MsgLog_Allow, "[1 3]", []uint32{1, 3}, []uint32{2}},
+		{"mode=deny&ids=2", MsgLog_Deny, "[2]", []uint32{1, 3}, []uint32{2}},
+		{"mode=off", MsgLog_Off, "[]", nil, []uint32{1, 2}},
+	}
+
+	for _, tc := range tests {
+		if code := adminRequest(admin, http.MethodPost, "/msglog?"+tc.query, ""); code != http.StatusOK {
+			t.Fatalf("%s: %d", tc.query, code)
+		}
+
+		if mode, ids := MsgLogSetting(); mode != tc.mode || fmt.Sprint(append([]uint32{}, ids...)) != tc.ids {
+			t.Fatalf("%s: setting %s %v", tc.query, mode, ids)
+		}
+
+		for _, id := range tc.logged {
+			if !msgLogEnabled(id) {
+				t.Fatalf("%s: msgid %d not logged", tc.query, id)
+			}
+		}
+
+		for _, id := range tc.skipped {
+			if msgLogEnabled(id) {
+				t.Fatalf("%s: msgid %d logged", tc.query, id)
+			}
+		}
+	}
+
+	if code := adminRequest(admin, http.MethodPost, "/msglog?mode=some", ""); code != http.StatusBadRequest {
+		t.Fatalf("unknown mode: %d", code)
+	}
+}
+
+func TestHandlerLogSwitch(t *testing.T) {
+	defer SetHandlerLog(false)
+
+	SetHandlerLog(true)
+	if !HandlerLogEnabled() {
+		t.Fatal("SetHandlerLog not applied")
+	}
+
+	SetHandlerLog(false)
+
+	// 兼容直接设置变量的用法
+	EnableHandlerLog = true
+	enabled := HandlerLogEnabled()
+	EnableHandlerLog = false
+
+	if !enabled {
+		t.Fatal("EnableHandlerLog ignored")
+	}
+}
@@ -0,0 +1,245 @@
+package socket
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// AdmissionHook 连接准入检查, 在创建Session之前调用, 返回false拒绝连接
+type AdmissionHook interface {
+	Admit(conn net.Conn) bool
+}
+
+// AdmissionReleaser 需要计数的准入检查实现此接口, 在连接断开或被后续检查拒绝时调用
+type AdmissionReleaser interface {
+	Release(conn net.Conn)
+}
+
+// AdmissionFunc 自定义准入检查
+type AdmissionFunc func(conn net.Conn) bool
+
+func (self AdmissionFunc) Admit(conn net.Conn) bool {
+	return self(conn)
+}
+
+// 按添加顺序执行的准入检查
+type admissionChain struct {
+	hooks []AdmissionHook
+	guard sync.RWMutex
+}
+
+func (self *admissionChain) Add(hook AdmissionHook) {
+	self.guard.Lock()
+	self.hooks = append(self.hooks, hook)
+	self.guard.Unlock()
+}
+
+// Admit 依次检查, 全部通过时返回通过的检查, 连接断开时只释放这些检查
+// 之后添加的检查不会被释放, 防止计数错误
+func (self *admissionChain) Admit(conn net.Conn) (admitted []AdmissionHook, ok bool) {
+	self.guard.RLock()
+	hooks := self.hooks
+	self.guard.RUnlock()
+
+	for index, hook := range hooks {
+		if !hook.Admit(conn) {
+			// 释放之前已通过的检查
+			releaseAdmission(hooks[:index], conn)
+			return nil, false
+		}
+	}
+
+	return hooks, true
+}
+
+func releaseAdmission(hooks []AdmissionHook, conn net.Conn) {
+	for index := len(hooks) - 1; index >= 0; index-- {
+		if releaser, ok := hooks[index].(AdmissionReleaser); ok {
+			releaser.Release(conn)
+		}
+	}
+}
+
+// MaxSessionsHook 限制同时存在的连接总数
+type MaxSessionsHook struct {
+	max   int64
+	count int64
+}
+
+func (self *MaxSessionsHook) Admit(conn net.Conn) bool {
+	if atomic.AddInt64(&self.count, 1) > atomic.LoadInt64(&self.max) {
+		atomic.AddInt64(&self.count, -1)
+		return false
+	}
+
+	return true
+}
+
+func (self *MaxSessionsHook) Release(conn net.Conn) {
+	atomic.AddInt64(&self.count, -1)
+}
+
+// SetMax 运行时修改上限, 不影响已存在的连接
+func (self *MaxSessionsHook) SetMax(max int) {
+	atomic.StoreInt64(&self.max, int64(max))
+}
+
+func NewMaxSessionsHook(max int) *MaxSessionsHook {
+	return &MaxSessionsHook{
+		max: int64(max),
+	}
+}
+
+// MaxSessionsPerIPHook 限制每个IP同时存在的连接数
+type MaxSessionsPerIPHook struct {
+	max       int
+	countByIP map[string]int
+	guard     sync.Mutex
+}
+
+func (self *MaxSessionsPerIPHook) Admit(conn net.Conn) bool {
+	ip := addrIP(conn.RemoteAddr())
+
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	if self.countByIP[ip] >= self.max {
+		return false
+	}
+
+	self.countByIP[ip]++
+
+	return true
+}
+
+func (self *MaxSessionsPerIPHook) Release(conn net.Conn) {
+	ip := addrIP(conn.RemoteAddr())
+
+	self.guard.Lock()
+
+	if self.countByIP[ip] <= 1 {
+		delete(self.countByIP, ip)
+	} else {
+		self.countByIP[ip]--
+	}
+
+	self.guard.Unlock()
+}
+
+// SetMax 运行时修改上限, 不影响已存在的连接
+func (self *MaxSessionsPerIPHook) SetMax(max int) {
+	self.guard.Lock()
+	self.max = max
+	self.guard.Unlock()
+}
+
+func NewMaxSessionsPerIPHook(max int) *MaxSessionsPerIPHook {
+	return &MaxSessionsPerIPHook{
+		max:       max,
+		countByIP: make(map[string]int),
+	}
+}
+
+// IPFilterHook 按CIDR名单过滤, 先检查拒绝名单, 允许名单不为空时只接受名单内的地址
+type IPFilterHook struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	guard sync.RWMutex
+}
+
+func (self *IPFilterHook) Admit(conn net.Conn) bool {
+	ip := net.ParseIP(addrIP(conn.RemoteAddr()))
+
+	self.guard.RLock()
+	defer self.guard.RUnlock()
+
+	if ip == nil {
+		return len(self.allow) == 0
+	}
+
+	if containsIP(self.deny, ip) {
+		return false
+	}
+
+	return len(self.allow) == 0 || containsIP(self.allow, ip)
+}
+
+// SetAllow 替换允许名单, 可在运行时重新加载
+func (self *IPFilterHook) SetAllow(cidrList []string) error {
+	list, err := parseCIDRList(cidrList)
+	if err != nil {
+		return err
+	}
+
+	self.guard.Lock()
+	self.allow = list
+	self.guard.Unlock()
+
+	return nil
+}
+
+// SetDeny 替换拒绝名单, 可在运行时重新加载
+func (self *IPFilterHook) SetDeny(cidrList []string) error {
+	list, err := parseCIDRList(cidrList)
+	if err != nil {
+		return err
+	}
+
+	self.guard.Lock()
+	self.deny = list
+	self.guard.Unlock()
+
+	return nil
+}
+
+func NewIPFilterHook(allow, deny []string) (*IPFilterHook, error) {
+	self := &IPFilterHook{}
+
+	if err := self.SetAllow(allow); err != nil {
+		return nil, err
+	}
+
+	if err := self.SetDeny(deny); err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+// 解析CIDR, 单个IP视为/32或/128
+func parseCIDRList(cidrList []string) ([]*net.IPNet, error) {
+	var list []*net.IPNet
+
+	for _, cidr := range cidrList {
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, ipnet)
+	}
+
+	return list, nil
+}
+
+func containsIP(list []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range list {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+package socket
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAdmissionRelease(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	total := NewMaxSessionsHook(1)
+	deny := false
+
+	chain := &admissionChain{}
+	chain.Add(total)
+	chain.Add(AdmissionFunc(func(conn net.Conn) bool {
+		return !deny
+	}))
+
+	// 被后续检查拒绝时释放之前通过的检查
+	deny = true
+	if _, ok := chain.Admit(conn); ok {
+		t.Fatal("denied connection admitted")
+	}
+
+	if total.count != 0 {
+		t.Fatalf("count %d after rejection, want 0", total.count)
+	}
+
+	deny = false
+	admitted, ok := chain.Admit(conn)
+	if !ok {
+		t.Fatal("connection rejected")
+	}
+
+	if _, ok := chain.Admit(conn); ok {
+		t.Fatal("connection over limit admitted")
+	}
+
+	// 连接存在期间添加的检查在断开时不释放
+	later := NewMaxSessionsHook(1)
+	chain.Add(later)
+
+	releaseAdmission(admitted, conn)
+
+	if total.count != 0 || later.count != 0 {
+		t.Fatalf("count %d and %d after release, want 0 and 0", total.count, later.count)
+	}
+}
+
+func TestMaxSessionsPerIP(t *testing.T) {
+	hook := NewMaxSessionsPerIPHook(1)
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	// 管道两端的地址相同, 视为同一IP
+	if !hook.Admit(a) || hook.Admit(b) {
+		t.Fatal("per ip limit not applied")
+	}
+
+	hook.Release(a)
+
+	if len(hook.countByIP) != 0 {
+		t.Fatalf("count kept after release: %v", hook.countByIP)
+	}
+
+	if !hook.Admit(b) {
+		t.Fatal("connection rejected after release")
+	}
+}
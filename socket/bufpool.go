@@ -0,0 +1,97 @@
+package socket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 缓冲池的分级大小, 超过最大级别的缓冲不进入池
+var bufferClasses = [...]int{64, 256, 1024, 4096, 16384, 65536}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+func init() {
+	for index := range bufferPools {
+		size := bufferClasses[index]
+
+		bufferPools[index].New = func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		}
+	}
+}
+
+// 找到能容纳size的最小级别, 没有返回-1
+func bufferClassIndex(size int) int {
+	for index, classSize := range bufferClasses {
+		if size <= classSize {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// AllocBuffer 从缓冲池分配长度为size的缓冲, 用完后使用FreeBuffer归还
+func AllocBuffer(size int) []byte {
+	index := bufferClassIndex(size)
+	if index == -1 {
+		return make([]byte, size)
+	}
+
+	buf := bufferPools[index].Get().(*[]byte)
+
+	return (*buf)[:size]
+}
+
+// FreeBuffer 归还AllocBuffer分配的缓冲, 归还后不能再使用
+func FreeBuffer(buf []byte) {
+	index := bufferClassIndex(cap(buf))
+
+	// 只回收容量与级别一致的缓冲, 其他来源的缓冲交给GC
+	if index == -1 || bufferClasses[index] != cap(buf) {
+		return
+	}
+
+	buf = buf[:cap(buf)]
+	bufferPools[index].Put(&buf)
+}
+
+// 引用计数的共享缓冲, 计数归零时归还缓冲池
+type sharedBuffer struct {
+	data []byte
+	refs int32
+}
+
+var sharedBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(sharedBuffer)
+	},
+}
+
+func newSharedBuffer(size int) *sharedBuffer {
+	self := sharedBufferPool.Get().(*sharedBuffer)
+	self.data = AllocBuffer(size)
+	self.refs = 1
+
+	return self
+}
+
+func (self *sharedBuffer) retain() {
+	atomic.AddInt32(&self.refs, 1)
+}
+
+func (self *sharedBuffer) shared() bool {
+	return atomic.LoadInt32(&self.refs) > 1
+}
+
+func (self *sharedBuffer) release() {
+	if atomic.AddInt32(&self.refs, -1) != 0 {
+		return
+	}
+
+	FreeBuffer(self.data)
+	self.data = nil
+
+	sharedBufferPool.Put(self)
+}
@@ -0,0 +1,113 @@
+package socket
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferClassIndex(t *testing.T) {
+	tests := []struct {
+		size  int
+		index int
+	}{
+		{0, 0},
+		{1, 0},
+		{64, 0},
+		{65, 1},
+		{256, 1},
+		{1000, 2},
+		{4096, 3},
+		{16384, 4},
+		{65536, 5},
+		{65537, -1},
+	}
+
+	for _, tc := range tests {
+		if index := bufferClassIndex(tc.size); index != tc.index {
+			t.Errorf("size %d: got class %d, want %d", tc.size, index, tc.index)
+		}
+	}
+}
+
+func TestAllocBuffer(t *testing.T) {
+	tests := []struct {
+		size int
+		cap  int
+	}{
+		{10, 64},
+		{300, 1024},
+		{65536, 65536},
+		{70000, 70000},
+	}
+
+	for _, tc := range tests {
+		buf := AllocBuffer(tc.size)
+
+		if len(buf) != tc.size || cap(buf) != tc.cap {
+			t.Errorf("size %d: got len %d cap %d, want cap %d", tc.size, len(buf), cap(buf), tc.cap)
+		}
+
+		FreeBuffer(buf)
+	}
+
+	// 容量与级别不一致的缓冲不进入池, 不应panic
+	FreeBuffer(make([]byte, 100))
+	FreeBuffer(nil)
+}
+
+func TestSharedBuffer(t *testing.T) {
+	buf := newSharedBuffer(10)
+
+	if buf.shared() {
+		t.Fatal("new buffer reported shared")
+	}
+
+	buf.retain()
+
+	if !buf.shared() {
+		t.Fatal("retained buffer not shared")
+	}
+
+	buf.release()
+
+	if buf.shared() || buf.data == nil {
+		t.Fatal("buffer freed while still referenced")
+	}
+
+	buf.release()
+
+	if buf.data != nil {
+		t.Fatal("buffer data kept after last release")
+	}
+}
+
+func TestEventCloneCopyOnWrite(t *testing.T) {
+	ev := NewEvent(Event_Recv, nil)
+	copy(ev.AllocData(5), "hello")
+
+	c := ev.Clone()
+
+	if &c.Data[0] != &ev.Data[0] {
+		t.Fatal("clone does not share data")
+	}
+
+	// 共享时写入先复制
+	data := c.MutableData()
+	data[0] = 'j'
+
+	if !bytes.Equal(ev.Data, []byte("hello")) {
+		t.Fatalf("original modified through clone: %s", ev.Data)
+	}
+
+	if !bytes.Equal(c.Data, []byte("jello")) {
+		t.Fatalf("clone data %s, want jello", c.Data)
+	}
+
+	// 不再共享时直接写入
+	if &ev.MutableData()[0] != &ev.Data[0] {
+		t.Fatal("unshared data copied")
+	}
+
+	c.Release()
+	ev.Release()
+}
@@ -0,0 +1,302 @@
+package socket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 抓包文件格式, 小端
+// 文件头: "RSCP" + 版本(uint16)
+// 记录: 时间(int64, UnixNano) + 会话ID(int64) + 方向(uint8) + MsgID(uint32) + Flags(uint16) + 长度(uint32) + Data
+const (
+	captureMagic      = "RSCP"
+	captureVersion    = 1
+	captureHeaderSize = 4 + 2
+	captureRecordSize = 8 + 8 + 1 + 4 + 2 + 4
+
+	// 写入后最长在缓冲中停留的时间, 进程崩溃时最多丢失这段时间的记录
+	captureFlushDelay = 100 * time.Millisecond
+)
+
+// CaptureDir 封包方向
+type CaptureDir uint8
+
+const (
+	Capture_In  CaptureDir = iota // 收到的封包
+	Capture_Out                   // 发出的封包
+)
+
+func (self CaptureDir) String() string {
+	switch self {
+	case Capture_In:
+		return "in"
+	case Capture_Out:
+		return "out"
+	}
+
+	return fmt.Sprintf("unknown(%d)", self)
+}
+
+// CaptureRecord 一个封包的记录
+type CaptureRecord struct {
+	Time      time.Time
+	SessionID int64
+	Dir       CaptureDir
+	MsgID     uint32
+	Flags     uint16
+	Data      []byte
+}
+
+func (self *CaptureRecord) String() string {
+	return fmt.Sprintf("%s sid: %d %s msgid: %d flags: %d size: %d", self.Time.Format("15:04:05.000000"), self.SessionID, self.Dir, self.MsgID, self.Flags, len(self.Data))
+}
+
+// CaptureFile 抓包文件, 多个会话的记录器共享写入
+type CaptureFile struct {
+	file   *os.File
+	writer *bufio.Writer
+	guard  sync.Mutex
+
+	err error // 第一个写入错误, 之后不再写入
+
+	flushPending bool // 已安排定时写出
+}
+
+// Write 写入一条记录
+func (self *CaptureFile) Write(rec *CaptureRecord) error {
+	var header [captureRecordSize]byte
+	binary.LittleEndian.PutUint64(header[0:], uint64(rec.Time.UnixNano()))
+	binary.LittleEndian.PutUint64(header[8:], uint64(rec.SessionID))
+	header[16] = byte(rec.Dir)
+	binary.LittleEndian.PutUint32(header[17:], rec.MsgID)
+	binary.LittleEndian.PutUint16(header[21:], rec.Flags)
+	binary.LittleEndian.PutUint32(header[23:], uint32(len(rec.Data)))
+
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	if self.err != nil {
+		return self.err
+	}
+
+	if _, err := self.writer.Write(header[:]); err != nil {
+		self.err = err
+		return err
+	}
+
+	if _, err := self.writer.Write(rec.Data); err != nil {
+		self.err = err
+		return err
+	}
+
+	// 缓冲中有数据时安排定时写出, 不需要每条记录都写文件
+	if !self.flushPending && self.writer.Buffered() > 0 {
+		self.flushPending = true
+		time.AfterFunc(captureFlushDelay, self.delayedFlush)
+	}
+
+	return nil
+}
+
+func (self *CaptureFile) delayedFlush() {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	self.flushPending = false
+
+	// 已关闭或出错
+	if self.err != nil {
+		return
+	}
+
+	if err := self.writer.Flush(); err != nil {
+		self.err = err
+	}
+}
+
+// Flush 写出缓冲中的记录
+func (self *CaptureFile) Flush() error {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	return self.writer.Flush()
+}
+
+// Close 写出缓冲并关闭文件, 之后记录器不再写入
+func (self *CaptureFile) Close() error {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	if self.err == nil {
+		self.err = errors.New("capture file closed")
+	}
+
+	if err := self.writer.Flush(); err != nil {
+		self.file.Close()
+		return err
+	}
+
+	return self.file.Close()
+}
+
+// NewRecorder 创建记录收发封包的处理器, 读链和写链中使用
+// 放在读链的封包读取之后和写链的封包写入之前时, 记录的是线路上的封包数据
+func (self *CaptureFile) NewRecorder() EventHandler {
+	return &captureRecorder{file: self}
+}
+
+// CreateCaptureFile 创建抓包文件, 已存在时覆盖
+func CreateCaptureFile(filename string) (*CaptureFile, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &CaptureFile{
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}
+
+	var header [captureHeaderSize]byte
+	copy(header[:], captureMagic)
+	binary.LittleEndian.PutUint16(header[4:], captureVersion)
+
+	if _, err := self.writer.Write(header[:]); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return self, nil
+}
+
+type captureRecorder struct {
+	file *CaptureFile
+}
+
+func (self *captureRecorder) Call(ev *Event) {
+	var dir CaptureDir
+
+	switch ev.Type {
+	case Event_Recv:
+		dir = Capture_In
+	case Event_Send:
+		dir = Capture_Out
+	default:
+		return
+	}
+
+	// 写入失败不影响收发
+	self.file.Write(&CaptureRecord{
+		Time:      time.Now(),
+		SessionID: ev.SessionID(),
+		Dir:       dir,
+		MsgID:     ev.MsgID,
+		Flags:     ev.Flags,
+		Data:      ev.Data,
+	})
+}
+
+// CaptureReader 读取抓包文件
+type CaptureReader struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+// Next 读取下一条记录, 没有更多记录时返回io.EOF
+func (self *CaptureReader) Next() (*CaptureRecord, error) {
+	var header [captureRecordSize]byte
+
+	if _, err := io.ReadFull(self.reader, header[:]); err != nil {
+		// 记录不完整, 如进程退出时没有写完
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+
+		return nil, err
+	}
+
+	rec := &CaptureRecord{
+		Time:      time.Unix(0, int64(binary.LittleEndian.Uint64(header[0:]))),
+		SessionID: int64(binary.LittleEndian.Uint64(header[8:])),
+		Dir:       CaptureDir(header[16]),
+		MsgID:     binary.LittleEndian.Uint32(header[17:]),
+		Flags:     binary.LittleEndian.Uint16(header[21:]),
+		Data:      make([]byte, binary.LittleEndian.Uint32(header[23:])),
+	}
+
+	if _, err := io.ReadFull(self.reader, rec.Data); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (self *CaptureReader) Close() error {
+	return self.file.Close()
+}
+
+// OpenCaptureFile 打开抓包文件读取
+func OpenCaptureFile(filename string) (*CaptureReader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &CaptureReader{
+		file:   file,
+		reader: bufio.NewReader(file),
+	}
+
+	var header [captureHeaderSize]byte
+	if _, err := io.ReadFull(self.reader, header[:]); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if string(header[:4]) != captureMagic {
+		file.Close()
+		return nil, fmt.Errorf("not a capture file: %s", filename)
+	}
+
+	if version := binary.LittleEndian.Uint16(header[4:]); version != captureVersion {
+		file.Close()
+		return nil, fmt.Errorf("unsupported capture version: %d", version)
+	}
+
+	return self, nil
+}
+
+// LoadCapture 读取抓包文件中的所有记录
+func LoadCapture(filename string) ([]*CaptureRecord, error) {
+	reader, err := OpenCaptureFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	var list []*CaptureRecord
+
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return list, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, rec)
+	}
+}
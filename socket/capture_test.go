@@ -0,0 +1,276 @@
+package socket
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCapture(t *testing.T, filename string, list ...*CaptureRecord) {
+	t.Helper()
+
+	file, err := CreateCaptureFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rec := range list {
+		if err := file.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sameRecord(a, b *CaptureRecord) bool {
+	return a.Time.Equal(b.Time) && a.SessionID == b.SessionID && a.Dir == b.Dir &&
+		a.MsgID == b.MsgID && a.Flags == b.Flags && bytes.Equal(a.Data, b.Data)
+}
+
+func TestCaptureRecorder(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.cap")
+
+	file, err := CreateCaptureFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ses := newIdleSession()
+	ses.SetID(7)
+
+	recorder := file.NewRecorder()
+
+	begin := time.Now()
+
+	for _, ev := range []*Event{
+		{Type: Event_Recv, MsgID: 1, Flags: 0x8001, Data: []byte("hello")},
+		{Type: Event_Accepted},
+		{Type: Event_Send, MsgID: 0xFFFFFFFF, Data: nil},
+	} {
+		ev.Ses = ses
+		recorder.Call(ev)
+	}
+
+	end := time.Now()
+
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadCapture(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 系统事件不记录
+	want := []*CaptureRecord{
+		{SessionID: 7, Dir: Capture_In, MsgID: 1, Flags: 0x8001, Data: []byte("hello")},
+		{SessionID: 7, Dir: Capture_Out, MsgID: 0xFFFFFFFF, Data: []byte{}},
+	}
+
+	if len(list) != len(want) {
+		t.Fatalf("loaded %d records, want %d", len(list), len(want))
+	}
+
+	for index, rec := range list {
+		if rec.Time.Before(begin) || rec.Time.After(end) {
+			t.Fatalf("record %d time %s out of range", index, rec.Time)
+		}
+
+		want[index].Time = rec.Time
+
+		if !sameRecord(rec, want[index]) {
+			t.Fatalf("record %d: %s, want %s", index, rec, want[index])
+		}
+	}
+}
+
+func TestCaptureRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.cap")
+
+	now := time.Unix(1700000000, 123456789)
+
+	list := []*CaptureRecord{
+		{Time: now, SessionID: 1, Dir: Capture_In, MsgID: 10, Flags: 1, Data: []byte("abc")},
+		{Time: now.Add(time.Millisecond), SessionID: -1, Dir: Capture_Out, MsgID: 11, Flags: 0xFFFF, Data: []byte{}},
+		{Time: now.Add(time.Second), SessionID: 1 << 40, Dir: Capture_In, MsgID: 12, Data: bytes.Repeat([]byte{0xAB}, 5000)},
+	}
+
+	writeCapture(t, filename, list...)
+
+	loaded, err := LoadCapture(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != len(list) {
+		t.Fatalf("loaded %d records, want %d", len(loaded), len(list))
+	}
+
+	for index := range list {
+		if !sameRecord(loaded[index], list[index]) {
+			t.Fatalf("record %d: %s, want %s", index, loaded[index], list[index])
+		}
+	}
+}
+
+func TestCaptureDelayedFlush(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.cap")
+
+	file, err := CreateCaptureFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	file.Write(&CaptureRecord{Time: time.Now(), SessionID: 1, Data: []byte("abc")})
+
+	// 不关闭文件, 记录在停留时间后写出
+	waitFor(t, "delayed flush", func() bool {
+		list, err := LoadCapture(filename)
+		return err == nil && len(list) == 1
+	})
+}
+
+func TestCaptureTruncated(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "full.cap")
+
+	writeCapture(t, filename,
+		&CaptureRecord{Time: time.Now(), SessionID: 1, MsgID: 1, Data: []byte("first")},
+		&CaptureRecord{Time: time.Now(), SessionID: 1, MsgID: 2, Data: []byte("second")},
+	)
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cut  int // 从文件末尾截掉的字节数
+	}{
+		{"in data", 1},
+		{"in header", len("second") + 1},
+		{"whole record", len("second") + captureRecordSize},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			truncated := filepath.Join(dir, "truncated.cap")
+
+			if err := os.WriteFile(truncated, data[:len(data)-tc.cut], 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := OpenCaptureFile(truncated)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer reader.Close()
+
+			if rec, err := reader.Next(); err != nil || string(rec.Data) != "first" {
+				t.Fatalf("first record: %v %v", rec, err)
+			}
+
+			// 不完整的最后一条记录按文件结束处理
+			if rec, err := reader.Next(); err != io.EOF {
+				t.Fatalf("truncated record: %v %v, want EOF", rec, err)
+			}
+
+			if list, err := LoadCapture(truncated); err != nil || len(list) != 1 {
+				t.Fatalf("loaded %d records: %v", len(list), err)
+			}
+		})
+	}
+}
+
+func TestCaptureBadHeader(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "bad.cap")
+
+	for _, data := range []string{"", "RSC", "XXXX\x01\x00", "RSCP\x02\x00"} {
+		if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadCapture(filename); err == nil {
+			t.Fatalf("loaded %q", data)
+		}
+	}
+}
+
+func TestReplayToPeer(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.cap")
+
+	now := time.Now()
+
+	writeCapture(t, filename,
+		&CaptureRecord{Time: now, SessionID: 3, Dir: Capture_In, MsgID: 1, Flags: 2, Data: []byte("login")},
+		&CaptureRecord{Time: now, SessionID: 3, Dir: Capture_Out, MsgID: 1, Data: []byte("ok")},
+		&CaptureRecord{Time: now, SessionID: 4, Dir: Capture_In, MsgID: 9, Data: []byte("other")},
+		&CaptureRecord{Time: now.Add(time.Millisecond), SessionID: 3, Dir: Capture_In, MsgID: 2, Data: []byte("move")},
+	)
+
+	// 没有指定会话时使用第一个会话, 只重放收到的封包
+	replayer, err := NewCaptureReplayer(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayer.SetSpeed(0)
+
+	if n := len(replayer.Records()); n != 2 {
+		t.Fatalf("%d records to replay, want 2", n)
+	}
+
+	server := newFramePeer()
+
+	var received []*CaptureRecord
+
+	server.AddChainRecv(NewHandlerChain(&traceHandler{name: "server", trace: new([]string), fn: func(ev *Event) {
+		if ev.Type == Event_Recv {
+			received = append(received, &CaptureRecord{SessionID: 3, Dir: Capture_In, MsgID: ev.MsgID, Flags: ev.Flags, Data: append([]byte(nil), ev.Data...)})
+		}
+	}}))
+
+	err = replayer.ReplayToPeer(server, func(client Peer) {
+		client.SetReadWriteChain(func() *HandlerChain {
+			return NewHandlerChain(NewLengthFrameReader())
+		}, func() *HandlerChain {
+			return NewHandlerChain(NewLengthFrameWriter())
+		})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("server received %d messages, want 2", len(received))
+	}
+
+	for index, rec := range replayer.Records() {
+		received[index].Time = rec.Time
+
+		if !sameRecord(received[index], rec) {
+			t.Fatalf("message %d: %s, want %s", index, received[index], rec)
+		}
+	}
+
+	// 重放结束后会话已从Peer移除
+	if n := server.SessionCount(); n != 0 {
+		t.Fatalf("%d sessions left", n)
+	}
+
+	if _, err := NewCaptureReplayer(filename, 5); err == nil {
+		t.Fatal("replayer created for session without records")
+	}
+}
@@ -0,0 +1,135 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec 消息编解码
+type Codec interface {
+	Name() string
+
+	Encode(msg interface{}) ([]byte, error)
+
+	// msg为消息结构体指针
+	Decode(data []byte, msg interface{}) error
+}
+
+type jsonCodec struct {
+}
+
+func (self *jsonCodec) Name() string {
+	return "json"
+}
+
+func (self *jsonCodec) Encode(msg interface{}) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (self *jsonCodec) Decode(data []byte, msg interface{}) error {
+	return json.Unmarshal(data, msg)
+}
+
+// JSONCodec 使用encoding/json的编解码
+var JSONCodec Codec = &jsonCodec{}
+
+var (
+	codecByName   = map[string]Codec{}
+	codecMapGuard sync.RWMutex
+)
+
+// RegisterCodec 注册编解码, 用于在配置中按名字引用
+func RegisterCodec(codec Codec) {
+	codecMapGuard.Lock()
+	codecByName[codec.Name()] = codec
+	codecMapGuard.Unlock()
+}
+
+// FetchCodec 按名字取编解码, 没有注册时返回nil
+func FetchCodec(name string) Codec {
+	codecMapGuard.RLock()
+	defer codecMapGuard.RUnlock()
+
+	return codecByName[name]
+}
+
+func init() {
+	RegisterCodec(JSONCodec)
+}
+
+// MessageMeta 消息ID与消息类型的对应关系
+type MessageMeta struct {
+	ID   uint32
+	Type reflect.Type // 消息结构体类型, 非指针
+}
+
+func (self *MessageMeta) String() string {
+	return fmt.Sprintf("%s(%d)", self.Type.Name(), self.ID)
+}
+
+// NewMessage 创建消息结构体指针
+func (self *MessageMeta) NewMessage() interface{} {
+	return reflect.New(self.Type).Interface()
+}
+
+var (
+	metaByID     = map[uint32]*MessageMeta{}
+	metaByType   = map[reflect.Type]*MessageMeta{}
+	metaMapGuard sync.RWMutex
+)
+
+func messageType(prototype interface{}) reflect.Type {
+	t := reflect.TypeOf(prototype)
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// RegisterMessageMeta 注册消息, prototype为消息结构体或其指针, ID或类型重复时panic
+func RegisterMessageMeta(id uint32, prototype interface{}) *MessageMeta {
+	meta := &MessageMeta{
+		ID:   id,
+		Type: messageType(prototype),
+	}
+
+	metaMapGuard.Lock()
+	defer metaMapGuard.Unlock()
+
+	if _, ok := metaByID[id]; ok {
+		panic(fmt.Sprintf("duplicate message id: %d", id))
+	}
+
+	if _, ok := metaByType[meta.Type]; ok {
+		panic("duplicate message type: " + meta.Type.String())
+	}
+
+	metaByID[id] = meta
+	metaByType[meta.Type] = meta
+
+	return meta
+}
+
+// MessageMetaByID 根据消息ID取消息信息, 没有注册时返回nil
+func MessageMetaByID(id uint32) *MessageMeta {
+	metaMapGuard.RLock()
+	defer metaMapGuard.RUnlock()
+
+	return metaByID[id]
+}
+
+// MessageMetaByMsg 根据消息或其原型取消息信息, 没有注册时返回nil
+func MessageMetaByMsg(msg interface{}) *MessageMeta {
+	if msg == nil {
+		return nil
+	}
+
+	metaMapGuard.RLock()
+	defer metaMapGuard.RUnlock()
+
+	return metaByType[messageType(msg)]
+}
@@ -3,6 +3,8 @@ package socket
 import (
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,17 +20,29 @@ type Connector interface {
 type socketConnector struct {
 	*socketPeer
 
-	autoReconnectSec int // 重连间隔时间, 0为不重连
+	autoReconnectSec int32 // 重连间隔时间, 0为不重连, 可在运行时修改
 
 	tryConnTimes int // 尝试连接次数
 
 	closeSignal chan bool
 
-	defaultSes Session
+	// 连接池等在其他线程读取
+	defaultSes      Session
+	defaultSesGuard sync.RWMutex
+}
+
+func (self *socketConnector) setDefaultSession(ses Session) {
+	self.defaultSesGuard.Lock()
+	self.defaultSes = ses
+	self.defaultSesGuard.Unlock()
 }
 
 func (self *socketConnector) SetAutoReconnectSec(sec int) {
-	self.autoReconnectSec = sec
+	atomic.StoreInt32(&self.autoReconnectSec, int32(sec))
+}
+
+func (self *socketConnector) reconnectSec() int {
+	return int(atomic.LoadInt32(&self.autoReconnectSec))
 }
 
 func (self *socketConnector) Start(address string) Peer {
@@ -38,6 +52,9 @@ func (self *socketConnector) Start(address string) Peer {
 		return self
 	}
 
+	// 在连接线程启动前标记, 使Start之后立即调用Stop也能停止
+	self.SetRunning(true)
+
 	go self.connect(address)
 
 	return self
@@ -49,7 +66,6 @@ func (self *socketConnector) connect(address string) {
 	defer func() {
 		fmt.Println("Dialx")
 	}()
-	self.SetRunning(true)
 	self.SetAddress(address)
 
 	for {
@@ -69,13 +85,13 @@ func (self *socketConnector) connect(address string) {
 				fmt.Println(err.Error())
 			}
 
-			// 没重连就退出
-			if self.autoReconnectSec == 0 {
+			// 没重连就退出/主动退出
+			if self.isStopping() || self.reconnectSec() == 0 {
 				break
 			}
 
 			// 有重连就等待
-			time.Sleep(time.Duration(self.autoReconnectSec) * time.Second)
+			time.Sleep(time.Duration(self.reconnectSec()) * time.Second)
 
 			// 继续连接
 			continue
@@ -84,32 +100,39 @@ func (self *socketConnector) connect(address string) {
 		// 创建Session
 		ses := newSession(conn, self)
 
-		self.defaultSes = ses
+		self.setDefaultSession(ses)
 		self.tryConnTimes = 0
 		self.Add(ses)
 
 		// 内部断开回调
-		ses.OnClose = func() {
+		ses.OnClose = func(reason CloseReason) {
 			self.Remove(ses)
 			self.closeSignal <- true
 		}
 
-		// 投递连接建立事件
-		// extend.PostSystemEvent(ses, cellnet.Event_Connected, self.ChainListRecv(), cellnet.Result_OK)
+		// 投递连接建立事件, 失败时关闭连接, 由收发线程完成清理并按需重连
+		if !ses.postSystemEvent(Event_Connected) {
+			ses.conn.Close()
+		}
+
+		// 连接过程中调用了Stop, 此时Stop取不到会话, 在这里关闭
+		if self.isStopping() {
+			ses.Close()
+		}
 
 		// 事件处理完成开始处理数据收发
 		ses.run()
 
 		if <-self.closeSignal {
-			self.defaultSes = nil
+			self.setDefaultSession(nil)
 
 			// 没重连就退出/主动退出
-			if self.isStopping() || self.autoReconnectSec == 0 {
+			if self.isStopping() || self.reconnectSec() == 0 {
 				break
 			}
 
 			// 有重连就等待
-			time.Sleep(time.Duration(self.autoReconnectSec) * time.Second)
+			time.Sleep(time.Duration(self.reconnectSec()) * time.Second)
 
 			// 继续连接
 			continue
@@ -132,8 +155,8 @@ func (self *socketConnector) Stop() {
 
 	self.startStopping()
 
-	if self.defaultSes != nil {
-		self.defaultSes.Close()
+	if ses := self.DefaultSession(); ses != nil {
+		ses.Close()
 	}
 
 	// 等待线程结束
@@ -141,6 +164,9 @@ func (self *socketConnector) Stop() {
 }
 
 func (self *socketConnector) DefaultSession() Session {
+	self.defaultSesGuard.RLock()
+	defer self.defaultSesGuard.RUnlock()
+
 	return self.defaultSes
 }
 
@@ -0,0 +1,508 @@
+package socket
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalancePolicy 连接池选择会话的方式
+type BalancePolicy int32
+
+const (
+	Balance_RoundRobin       BalancePolicy = iota // 轮询
+	Balance_LeastOutstanding                      // 未完成请求最少
+	Balance_ConsistentHash                        // 按key一致性哈希, 同一key总是选择同一地址
+)
+
+func (self BalancePolicy) String() string {
+	switch self {
+	case Balance_RoundRobin:
+		return "roundrobin"
+	case Balance_LeastOutstanding:
+		return "leastoutstanding"
+	case Balance_ConsistentHash:
+		return "consistenthash"
+	}
+
+	return fmt.Sprintf("unknown(%d)", self)
+}
+
+// 一致性哈希中每个地址的虚拟节点数
+const hashRingReplicas = 100
+
+// 自动摘除的默认设置
+const (
+	defaultPoolMaxFailures    = 3
+	defaultPoolEjectTime      = 10 * time.Second
+	defaultPoolRequestTimeout = 10 * time.Second
+)
+
+// 通过Request发送, 等待回应的请求
+type poolRequest struct {
+	replyMsgID uint32
+	timer      *time.Timer
+}
+
+// 连接池中的一个连接
+type poolConn struct {
+	p    Peer
+	pool *ConnectorPool
+
+	// 等待回应的请求, 数量即未完成请求数
+	pending      []*poolRequest
+	pendingGuard sync.Mutex
+	outstanding  int64
+
+	// 连续失败次数, 请求超时和连接异常断开计为失败, 收到回应时清零
+	failures int32
+
+	// 被Eject摘除的会话id, 重连后的新会话恢复使用
+	ejectedID int64
+
+	// 自动摘除到此时间(UnixNano)之前不使用
+	ejectedUntil int64
+}
+
+// 可用的会话, 断开, 重连中或被摘除时返回nil
+func (self *poolConn) session() Session {
+	ses := self.p.(Connector).DefaultSession()
+	if ses == nil || ses.ID() == atomic.LoadInt64(&self.ejectedID) {
+		return nil
+	}
+
+	if time.Now().UnixNano() < atomic.LoadInt64(&self.ejectedUntil) {
+		return nil
+	}
+
+	return ses
+}
+
+// 记录一个等待replyMsgID回应的请求, 超时后计为失败
+func (self *poolConn) addRequest(replyMsgID uint32, timeout time.Duration) {
+	req := &poolRequest{replyMsgID: replyMsgID}
+
+	self.pendingGuard.Lock()
+
+	self.pending = append(self.pending, req)
+	atomic.AddInt64(&self.outstanding, 1)
+
+	if timeout > 0 {
+		req.timer = time.AfterFunc(timeout, func() {
+			if self.removeRequest(req) {
+				fmt.Printf("pool %s: request timeout %s, reply msgid: %d\n", self.pool.service, self.p.Address(), replyMsgID)
+				self.fail()
+			}
+		})
+	}
+
+	self.pendingGuard.Unlock()
+}
+
+func (self *poolConn) removeRequest(req *poolRequest) bool {
+	self.pendingGuard.Lock()
+	defer self.pendingGuard.Unlock()
+
+	for index, r := range self.pending {
+		if r == req {
+			self.removeAt(index)
+			return true
+		}
+	}
+
+	return false
+}
+
+// 收到消息时完成最早的一个等待此消息的请求, 其他消息不影响未完成请求数
+func (self *poolConn) complete(msgID uint32) {
+	self.pendingGuard.Lock()
+	defer self.pendingGuard.Unlock()
+
+	for index, r := range self.pending {
+		if r.replyMsgID == msgID {
+			self.removeAt(index)
+			atomic.StoreInt32(&self.failures, 0)
+			return
+		}
+	}
+}
+
+// 调用时需要持有pendingGuard
+func (self *poolConn) removeAt(index int) {
+	if timer := self.pending[index].timer; timer != nil {
+		timer.Stop()
+	}
+
+	self.pending = append(self.pending[:index], self.pending[index+1:]...)
+	atomic.AddInt64(&self.outstanding, -1)
+}
+
+// 会话断开后不会再有回应, 清除所有请求
+func (self *poolConn) clearRequests() {
+	self.pendingGuard.Lock()
+
+	for index := len(self.pending) - 1; index >= 0; index-- {
+		self.removeAt(index)
+	}
+
+	self.pendingGuard.Unlock()
+}
+
+// 记录一次失败, 连续失败达到上限时摘除连接并断开, 重连后等到摘除时间结束再使用
+func (self *poolConn) fail() {
+	maxFailures, ejectTime := self.pool.HealthCheck()
+
+	failures := atomic.AddInt32(&self.failures, 1)
+	if maxFailures <= 0 || int(failures) < maxFailures {
+		return
+	}
+
+	atomic.StoreInt32(&self.failures, 0)
+	atomic.StoreInt64(&self.ejectedUntil, time.Now().Add(ejectTime).UnixNano())
+
+	fmt.Printf("pool %s: eject %s for %s after %d failures\n", self.pool.service, self.p.Address(), ejectTime, failures)
+
+	if ses := self.p.(Connector).DefaultSession(); ses != nil {
+		ses.CloseWithReason(Result_RequestClose, nil)
+	}
+}
+
+// 接收处理链, 统计请求回应和连接异常断开
+func (self *poolConn) Call(ev *Event) {
+	switch ev.Type {
+	case Event_Recv:
+		self.complete(ev.MsgID)
+	case Event_Closed:
+		self.clearRequests()
+
+		// 主动断开和摘除不计为失败
+		if reason, ok := ev.Msg.(CloseReason); ok && reason.Result != Result_OK && reason.Result != Result_RequestClose {
+			self.fail()
+		}
+	}
+}
+
+type hashRingNode struct {
+	hash uint32
+	addr string
+}
+
+// 连接池快照, 修改时整体替换, 选择会话时不需要加锁
+type poolSnapshot struct {
+	conns  []*poolConn
+	byAddr map[string][]*poolConn
+	ring   []hashRingNode
+}
+
+// ConnectorPool 连接池, 对服务的每个地址保持N个连接, 按策略选择会话
+// 断开重连中的连接, 被Eject摘除的会话和自动摘除的连接不会被选中
+// 连续失败(请求超时或连接异常断开)达到上限时自动摘除连接, 参见SetHealthCheck
+type ConnectorPool struct {
+	// 地址解析和连接管理
+	*ServiceConnector
+
+	policy int32 // BalancePolicy
+
+	// 新建Connector后, 启动前调用, 用于设置处理链和选项
+	setup func(p Peer)
+
+	// 只在ServiceConnector的回调中修改, 由其connectorsGuard保护
+	connByPeer map[Peer]*poolConn
+
+	snapshot atomic.Value // *poolSnapshot
+
+	rrIndex uint64
+
+	// 自动摘除和请求超时
+	maxFailures    int32
+	ejectTime      int64 // time.Duration
+	requestTimeout int64 // time.Duration
+}
+
+// SetBalancePolicy 设置选择会话的方式, 默认轮询
+func (self *ConnectorPool) SetBalancePolicy(policy BalancePolicy) {
+	atomic.StoreInt32(&self.policy, int32(policy))
+}
+
+func (self *ConnectorPool) BalancePolicy() BalancePolicy {
+	return BalancePolicy(atomic.LoadInt32(&self.policy))
+}
+
+// SetHealthCheck 连续失败maxFailures次时摘除连接ejectTime, maxFailures为0时不自动摘除, 默认3次, 10秒
+func (self *ConnectorPool) SetHealthCheck(maxFailures int, ejectTime time.Duration) {
+	atomic.StoreInt32(&self.maxFailures, int32(maxFailures))
+	atomic.StoreInt64(&self.ejectTime, int64(ejectTime))
+}
+
+func (self *ConnectorPool) HealthCheck() (maxFailures int, ejectTime time.Duration) {
+	return int(atomic.LoadInt32(&self.maxFailures)), time.Duration(atomic.LoadInt64(&self.ejectTime))
+}
+
+// SetRequestTimeout 设置Request等待回应的时间, 超时计为失败, 0表示不超时, 默认10秒
+func (self *ConnectorPool) SetRequestTimeout(d time.Duration) {
+	atomic.StoreInt64(&self.requestTimeout, int64(d))
+}
+
+func (self *ConnectorPool) load() *poolSnapshot {
+	snapshot, _ := self.snapshot.Load().(*poolSnapshot)
+	if snapshot == nil {
+		return &poolSnapshot{}
+	}
+
+	return snapshot
+}
+
+// 新建的Connector, 在所有接收处理链之前统计回应
+func (self *ConnectorPool) setupConn(p Peer) {
+	pc := &poolConn{p: p, pool: self, ejectedID: -1}
+
+	if self.setup != nil {
+		self.setup(p)
+	}
+
+	p.AddChainRecvWithPriority(NewHandlerChain(pc), math.MinInt32)
+
+	self.connByPeer[p] = pc
+}
+
+// 连接变化后重建快照
+func (self *ConnectorPool) updateSnapshot(byAddr map[string][]Peer) {
+	connByAddr := make(map[string][]*poolConn, len(byAddr))
+	exists := make(map[Peer]bool)
+
+	for addr, list := range byAddr {
+		for _, p := range list {
+			connByAddr[addr] = append(connByAddr[addr], self.connByPeer[p])
+			exists[p] = true
+		}
+	}
+
+	// 移除的连接不再有回应, 停止请求超时
+	for p, pc := range self.connByPeer {
+		if !exists[p] {
+			pc.clearRequests()
+			delete(self.connByPeer, p)
+		}
+	}
+
+	self.snapshot.Store(newPoolSnapshot(connByAddr))
+}
+
+func newPoolSnapshot(byAddr map[string][]*poolConn) *poolSnapshot {
+	self := &poolSnapshot{byAddr: byAddr}
+
+	addrs := make([]string, 0, len(byAddr))
+	for addr := range byAddr {
+		addrs = append(addrs, addr)
+	}
+
+	sort.Strings(addrs)
+
+	for _, addr := range addrs {
+		self.conns = append(self.conns, byAddr[addr]...)
+
+		for index := 0; index < hashRingReplicas; index++ {
+			self.ring = append(self.ring, hashRingNode{
+				hash: hashKey(fmt.Sprintf("%s#%d", addr, index)),
+				addr: addr,
+			})
+		}
+	}
+
+	sort.Slice(self.ring, func(i, j int) bool {
+		return self.ring[i].hash < self.ring[j].hash
+	})
+
+	return self
+}
+
+// 相近的key(如相同地址的虚拟节点)需要分布均匀, 使用sha256
+func hashKey(key string) uint32 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// Pick 按策略选择一个可用会话, 没有可用会话时返回nil
+// key只在一致性哈希时使用, 如玩家ID
+func (self *ConnectorPool) Pick(key string) Session {
+	pc := self.pick(key)
+	if pc == nil {
+		return nil
+	}
+
+	return pc.session()
+}
+
+func (self *ConnectorPool) pick(key string) *poolConn {
+	snapshot := self.load()
+
+	switch self.BalancePolicy() {
+	case Balance_LeastOutstanding:
+		return self.pickLeastOutstanding(snapshot.conns)
+	case Balance_ConsistentHash:
+		return self.pickByHash(snapshot, key)
+	}
+
+	return self.pickRoundRobin(snapshot.conns)
+}
+
+func (self *ConnectorPool) pickRoundRobin(list []*poolConn) *poolConn {
+	if len(list) == 0 {
+		return nil
+	}
+
+	start := atomic.AddUint64(&self.rrIndex, 1)
+
+	for index := range list {
+		pc := list[(start+uint64(index))%uint64(len(list))]
+
+		if pc.session() != nil {
+			return pc
+		}
+	}
+
+	return nil
+}
+
+// 未完成请求数相同时从轮询位置开始, 使请求分散
+func (self *ConnectorPool) pickLeastOutstanding(list []*poolConn) (ret *poolConn) {
+	if len(list) == 0 {
+		return nil
+	}
+
+	start := atomic.AddUint64(&self.rrIndex, 1)
+
+	var least int64
+
+	for index := range list {
+		pc := list[(start+uint64(index))%uint64(len(list))]
+
+		if pc.session() == nil {
+			continue
+		}
+
+		outstanding := atomic.LoadInt64(&pc.outstanding)
+
+		if ret == nil || outstanding < least {
+			ret, least = pc, outstanding
+		}
+	}
+
+	return
+}
+
+// 在哈希环上找到key对应的地址, 地址没有可用连接时顺延到下一个地址
+func (self *ConnectorPool) pickByHash(snapshot *poolSnapshot, key string) *poolConn {
+	ring := snapshot.ring
+	if len(ring) == 0 {
+		return nil
+	}
+
+	hash := hashKey(key)
+
+	start := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= hash
+	})
+
+	tried := make(map[string]bool)
+
+	for index := 0; index < len(ring) && len(tried) < len(snapshot.byAddr); index++ {
+		addr := ring[(start+index)%len(ring)].addr
+
+		if tried[addr] {
+			continue
+		}
+
+		tried[addr] = true
+
+		if pc := self.pickRoundRobin(snapshot.byAddr[addr]); pc != nil {
+			return pc
+		}
+	}
+
+	return nil
+}
+
+// Send 选择会话并发送, 不等待回应, 没有可用会话时返回false
+func (self *ConnectorPool) Send(key string, msg interface{}) bool {
+	ses := self.Pick(key)
+	if ses == nil {
+		return false
+	}
+
+	ses.Send(msg)
+
+	return true
+}
+
+// Request 选择会话并发送请求, 收到MsgID为replyMsgID的消息时完成, 没有可用会话时返回false
+// 同一连接上等待相同回应的请求按发送顺序完成, 未完成的请求数用于Balance_LeastOutstanding
+// 超时(SetRequestTimeout)计为失败
+func (self *ConnectorPool) Request(key string, msg interface{}, replyMsgID uint32) bool {
+	pc := self.pick(key)
+	if pc == nil {
+		return false
+	}
+
+	ses := pc.session()
+	if ses == nil {
+		return false
+	}
+
+	// 先记录再发送, 防止回应先于记录到达
+	pc.addRequest(replyMsgID, time.Duration(atomic.LoadInt64(&self.requestTimeout)))
+
+	ses.Send(msg)
+
+	return true
+}
+
+// Eject 摘除会话并断开, 所属连接重连成功后恢复使用
+func (self *ConnectorPool) Eject(ses Session) {
+	for _, pc := range self.load().conns {
+		if pc.p.(Connector).DefaultSession() == ses {
+			atomic.StoreInt64(&pc.ejectedID, ses.ID())
+			ses.CloseWithReason(Result_RequestClose, nil)
+			return
+		}
+	}
+}
+
+// Sessions 当前所有可用会话
+func (self *ConnectorPool) Sessions() []Session {
+	var list []Session
+
+	for _, pc := range self.load().conns {
+		if ses := pc.session(); ses != nil {
+			list = append(list, ses)
+		}
+	}
+
+	return list
+}
+
+// NewConnectorPool 创建连接池, 对每个地址建立connsPerAddr个连接
+// setup在每个Connector启动前调用, 可以为nil, 需要开启自动重连才能在断开后恢复
+func NewConnectorPool(service string, resolver Resolver, connsPerAddr int, setup func(p Peer)) *ConnectorPool {
+	if connsPerAddr <= 0 {
+		connsPerAddr = 1
+	}
+
+	self := &ConnectorPool{
+		setup:          setup,
+		connByPeer:     make(map[Peer]*poolConn),
+		maxFailures:    defaultPoolMaxFailures,
+		ejectTime:      int64(defaultPoolEjectTime),
+		requestTimeout: int64(defaultPoolRequestTimeout),
+	}
+
+	self.ServiceConnector = newServiceConnector(service, resolver, connsPerAddr, self.setupConn)
+	self.ServiceConnector.onUpdate = self.updateSnapshot
+
+	return self
+}
@@ -0,0 +1,273 @@
+package socket
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 不启动的连接池, 每个地址一个Connector, 使用未启动的会话作为连接
+type testPool struct {
+	*ConnectorPool
+
+	peerByAddr map[string]Peer
+	addrBySes  map[Session]string
+}
+
+func newTestPool(addrs ...string) *testPool {
+	self := &testPool{
+		ConnectorPool: NewConnectorPool("svc", NewStaticResolver(nil), 1, nil),
+		peerByAddr:    make(map[string]Peer),
+		addrBySes:     make(map[Session]string),
+	}
+
+	self.SetRequestTimeout(0)
+
+	self.update(addrs...)
+
+	return self
+}
+
+// 按地址列表更新连接, 已有的地址保留原连接
+func (self *testPool) update(addrs ...string) {
+	byAddr := make(map[string][]Peer)
+
+	for _, addr := range addrs {
+		p, ok := self.peerByAddr[addr]
+		if !ok {
+			p = NewConnector()
+			self.ConnectorPool.setupConn(p)
+
+			ses := newIdleSession()
+			ses.SetID(int64(len(self.addrBySes) + 1))
+			p.(*socketConnector).setDefaultSession(ses)
+
+			self.peerByAddr[addr] = p
+			self.addrBySes[ses] = addr
+		}
+
+		byAddr[addr] = []Peer{p}
+	}
+
+	self.updateSnapshot(byAddr)
+}
+
+func (self *testPool) pickAddr(key string) string {
+	return self.addrBySes[self.Pick(key)]
+}
+
+// 投递到地址对应连接的接收处理链
+func (self *testPool) post(addr string, ev *Event) {
+	p := self.peerByAddr[addr]
+	ev.Ses = p.(Connector).DefaultSession()
+
+	p.ChainListRecv().Call(ev)
+	ev.Release()
+}
+
+func (self *testPool) reply(addr string, msgID uint32) {
+	ev := NewEvent(Event_Recv, nil)
+	ev.MsgID = msgID
+	self.post(addr, ev)
+}
+
+func (self *testPool) closed(addr string, r Result) {
+	ev := NewEvent(Event_Closed, nil)
+	ev.Msg = CloseReason{Result: r}
+	self.post(addr, ev)
+}
+
+func (self *testPool) outstanding(addr string) int64 {
+	return atomic.LoadInt64(&self.connByPeer[self.peerByAddr[addr]].outstanding)
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	pool := newTestPool("a", "b", "c")
+
+	var picks []string
+	for i := 0; i < 6; i++ {
+		picks = append(picks, pool.pickAddr(""))
+	}
+
+	// 每轮依次选择所有地址
+	first := append([]string(nil), picks[:3]...)
+	sort.Strings(first)
+
+	if fmt.Sprint(first) != "[a b c]" {
+		t.Fatalf("picks %v", picks)
+	}
+
+	for i := 3; i < 6; i++ {
+		if picks[i] != picks[i-3] {
+			t.Fatalf("picks %v, not in order", picks)
+		}
+	}
+
+	// 被摘除的会话不再选择
+	pool.Eject(pool.peerByAddr["b"].(Connector).DefaultSession())
+
+	for i := 0; i < 6; i++ {
+		if addr := pool.pickAddr(""); addr == "b" || addr == "" {
+			t.Fatalf("picked %q after eject", addr)
+		}
+	}
+}
+
+func TestPoolLeastOutstanding(t *testing.T) {
+	pool := newTestPool("a", "b")
+	pool.SetBalancePolicy(Balance_LeastOutstanding)
+
+	const replyID = 100
+
+	pool.Request("", "req", replyID)
+	pool.Request("", "req", replyID)
+
+	// 未完成请求数相同时分散到所有连接
+	if pool.outstanding("a") != 1 || pool.outstanding("b") != 1 {
+		t.Fatalf("outstanding a: %d b: %d", pool.outstanding("a"), pool.outstanding("b"))
+	}
+
+	// 其他消息不影响未完成请求数
+	pool.reply("b", replyID+1)
+
+	if pool.outstanding("b") != 1 {
+		t.Fatalf("outstanding b: %d after other message", pool.outstanding("b"))
+	}
+
+	pool.reply("b", replyID)
+
+	if pool.outstanding("b") != 0 {
+		t.Fatalf("outstanding b: %d after reply", pool.outstanding("b"))
+	}
+
+	for i := 0; i < 3; i++ {
+		if addr := pool.pickAddr(""); addr != "b" {
+			t.Fatalf("picked %s, want least outstanding b", addr)
+		}
+	}
+
+	// 断开后清除未完成请求
+	pool.closed("a", Result_RequestClose)
+
+	if pool.outstanding("a") != 0 {
+		t.Fatalf("outstanding a: %d after close", pool.outstanding("a"))
+	}
+}
+
+func TestPoolConsistentHash(t *testing.T) {
+	pool := newTestPool("a", "b", "c")
+	pool.SetBalancePolicy(Balance_ConsistentHash)
+
+	const keys = 1000
+
+	pickAll := func() []string {
+		list := make([]string, keys)
+		for index := range list {
+			list[index] = pool.pickAddr(strconv.Itoa(index))
+		}
+
+		return list
+	}
+
+	before := pickAll()
+
+	// 同一key总是选择同一地址
+	for index, addr := range pickAll() {
+		if addr != before[index] {
+			t.Fatalf("key %d moved from %s to %s", index, before[index], addr)
+		}
+	}
+
+	// 增加地址时, 只有移动到新地址的key改变
+	pool.update("a", "b", "c", "d")
+
+	var moved int
+	for index, addr := range pickAll() {
+		if addr == before[index] {
+			continue
+		}
+
+		if addr != "d" {
+			t.Fatalf("key %d moved from %s to %s", index, before[index], addr)
+		}
+
+		moved++
+	}
+
+	if moved == 0 || moved > keys/2 {
+		t.Fatalf("%d of %d keys moved to new address", moved, keys)
+	}
+
+	// 移除地址时, 只有原来在该地址的key改变
+	pool.update("a", "c")
+
+	for index, addr := range pickAll() {
+		if before[index] != "b" && addr != before[index] {
+			t.Fatalf("key %d moved from %s to %s", index, before[index], addr)
+		}
+
+		if addr == "b" {
+			t.Fatalf("key %d picked removed address", index)
+		}
+	}
+}
+
+func TestPoolAutoEject(t *testing.T) {
+	pool := newTestPool("a")
+	pool.SetHealthCheck(2, time.Hour)
+
+	ses := pool.peerByAddr["a"].(Connector).DefaultSession()
+
+	// 收到回应时清零连续失败次数
+	pool.closed("a", Result_SocketError)
+	pool.Request("a", "req", 100)
+	pool.reply("a", 100)
+	pool.closed("a", Result_SocketError)
+
+	if ses.CloseReason().Result != Result_OK {
+		t.Fatalf("ejected after reply reset failures: %s", ses.CloseReason())
+	}
+
+	// 主动断开不计为失败
+	pool.closed("a", Result_RequestClose)
+
+	if ses.CloseReason().Result != Result_OK {
+		t.Fatalf("ejected after request close: %s", ses.CloseReason())
+	}
+
+	pool.closed("a", Result_SocketError)
+
+	if ses.CloseReason().Result != Result_RequestClose {
+		t.Fatal("not closed after 2 failures")
+	}
+
+	if picked := pool.Pick(""); picked != nil {
+		t.Fatalf("picked %d after auto eject", picked.ID())
+	}
+}
+
+func TestPoolRequestTimeout(t *testing.T) {
+	pool := newTestPool("a")
+	pool.SetHealthCheck(1, time.Hour)
+	pool.SetRequestTimeout(10 * time.Millisecond)
+
+	if !pool.Request("", "req", 100) {
+		t.Fatal("request not sent")
+	}
+
+	// 超时计为失败, 达到上限后摘除
+	waitFor(t, "request timeout", func() bool {
+		return pool.Pick("") == nil
+	})
+
+	if n := pool.outstanding("a"); n != 0 {
+		t.Fatalf("outstanding %d after timeout", n)
+	}
+
+	if pool.Request("", "req", 100) {
+		t.Fatal("request sent to ejected connection")
+	}
+}
@@ -0,0 +1,191 @@
+package socket
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RouteStat 单个消息ID的处理统计
+type RouteStat struct {
+	MsgID     uint32
+	Count     int64         // 处理次数
+	Failed    int64         // 解码失败次数
+	TotalTime time.Duration // 回调总耗时
+}
+
+type dispatchRoute struct {
+	meta     *MessageMeta // 为nil时不解码, 回调自行处理Data
+	callback func(ev *Event)
+
+	count     int64
+	failed    int64
+	totalTime int64
+}
+
+// Dispatcher 按MsgID分发消息, 放在接收处理链中
+// 注册了消息信息的消息, 分发前解码到ev.Msg
+type Dispatcher struct {
+	codec Codec
+
+	routeByID  map[uint32]*dispatchRoute
+	routeGuard sync.RWMutex
+
+	// 没有注册的消息
+	defaultCallback func(ev *Event)
+	unknownCount    int64
+}
+
+// RegisterMessage 注册消息回调, idOrPrototype为任意整数类型的消息ID或RegisterMessageMeta注册过的消息原型
+// 重复注册同一消息ID时, 新的回调替换旧的
+func (self *Dispatcher) RegisterMessage(idOrPrototype interface{}, callback func(ev *Event)) {
+	route := &dispatchRoute{
+		callback: callback,
+	}
+
+	id, isID := messageID(idOrPrototype)
+
+	if isID {
+		route.meta = MessageMetaByID(id)
+	} else {
+		route.meta = MessageMetaByMsg(idOrPrototype)
+		if route.meta == nil {
+			panic(fmt.Sprintf("message meta not registered: %T", idOrPrototype))
+		}
+
+		id = route.meta.ID
+	}
+
+	self.routeGuard.Lock()
+	self.routeByID[id] = route
+	self.routeGuard.Unlock()
+}
+
+// 任意整数类型的消息ID转为uint32, 不是整数时返回false, 超出uint32范围时panic
+func messageID(v interface{}) (uint32, bool) {
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := rv.Int(); n >= 0 && n <= math.MaxUint32 {
+			return uint32(n), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := rv.Uint(); n <= math.MaxUint32 {
+			return uint32(n), true
+		}
+	default:
+		return 0, false
+	}
+
+	panic(fmt.Sprintf("message id out of uint32 range: %v", v))
+}
+
+// SetDefaultHandler 设置没有注册的消息的回调
+func (self *Dispatcher) SetDefaultHandler(callback func(ev *Event)) {
+	self.routeGuard.Lock()
+	self.defaultCallback = callback
+	self.routeGuard.Unlock()
+}
+
+// Handle 以消息类型注册回调, T需要用RegisterMessageMeta注册
+func Handle[T any](dispatcher *Dispatcher, callback func(ses Session, msg *T)) {
+	var prototype *T
+
+	dispatcher.RegisterMessage(prototype, func(ev *Event) {
+		if msg, ok := ev.Msg.(*T); ok {
+			callback(ev.Ses, msg)
+		}
+	})
+}
+
+func (self *Dispatcher) Call(ev *Event) {
+	if ev.Type != Event_Recv {
+		return
+	}
+
+	self.routeGuard.RLock()
+	route, ok := self.routeByID[ev.MsgID]
+	defaultCallback := self.defaultCallback
+	self.routeGuard.RUnlock()
+
+	if !ok {
+		atomic.AddInt64(&self.unknownCount, 1)
+
+		if defaultCallback != nil {
+			defaultCallback(ev)
+		}
+
+		return
+	}
+
+	if route.meta != nil && ev.Msg == nil {
+		msg := route.meta.NewMessage()
+
+		if err := self.codec.Decode(ev.Data, msg); err != nil {
+			atomic.AddInt64(&route.failed, 1)
+			ev.SetResult(Result_CodecError)
+			return
+		}
+
+		ev.Msg = msg
+	}
+
+	begin := time.Now()
+
+	route.callback(ev)
+
+	atomic.AddInt64(&route.count, 1)
+	atomic.AddInt64(&route.totalTime, int64(time.Since(begin)))
+}
+
+// RouteStats 各消息ID的处理统计, 按MsgID排序
+func (self *Dispatcher) RouteStats() []RouteStat {
+	self.routeGuard.RLock()
+	defer self.routeGuard.RUnlock()
+
+	list := make([]RouteStat, 0, len(self.routeByID))
+
+	for id, route := range self.routeByID {
+		list = append(list, RouteStat{
+			MsgID:     id,
+			Count:     atomic.LoadInt64(&route.count),
+			Failed:    atomic.LoadInt64(&route.failed),
+			TotalTime: time.Duration(atomic.LoadInt64(&route.totalTime)),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].MsgID < list[j].MsgID
+	})
+
+	return list
+}
+
+// UnknownCount 没有注册的消息数量
+func (self *Dispatcher) UnknownCount() int64 {
+	return atomic.LoadInt64(&self.unknownCount)
+}
+
+func (self *Dispatcher) String() string {
+	self.routeGuard.RLock()
+	defer self.routeGuard.RUnlock()
+
+	return fmt.Sprintf("Dispatcher(%d routes)", len(self.routeByID))
+}
+
+// NewDispatcher 创建分发器, codec用于解码注册了消息信息的消息, 为nil时使用JSONCodec
+func NewDispatcher(codec Codec) *Dispatcher {
+	if codec == nil {
+		codec = JSONCodec
+	}
+
+	return &Dispatcher{
+		codec:     codec,
+		routeByID: make(map[uint32]*dispatchRoute),
+	}
+}
@@ -0,0 +1,82 @@
+package socket
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+type testDispatchMsg struct {
+	Value int
+}
+
+type testUnregisteredMsg struct{}
+
+type testMsgID uint16
+
+var testDispatchMeta = RegisterMessageMeta(40001, (*testDispatchMsg)(nil))
+
+func TestMessageID(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		id   uint32
+		isID bool
+	}{
+		{1, 1, true},
+		{int8(2), 2, true},
+		{int64(math.MaxUint32), math.MaxUint32, true},
+		{uint16(3), 3, true},
+		{uint64(4), 4, true},
+		{testMsgID(5), 5, true},
+		{"6", 0, false},
+		{(*testDispatchMsg)(nil), 0, false},
+	}
+
+	for _, tc := range tests {
+		id, isID := messageID(tc.v)
+
+		if id != tc.id || isID != tc.isID {
+			t.Errorf("%T(%v): got %d %v, want %d %v", tc.v, tc.v, id, isID, tc.id, tc.isID)
+		}
+	}
+
+	for _, v := range []interface{}{-1, int64(math.MaxUint32 + 1), uint64(math.MaxUint64)} {
+		expectPanic(t, fmt.Sprintf("%T(%v)", v, v), func() {
+			messageID(v)
+		})
+	}
+}
+
+func TestDispatcherRegister(t *testing.T) {
+	var got []int
+
+	dispatcher := NewDispatcher(nil)
+
+	// 以任意整数类型的ID注册的消息同样解码
+	dispatcher.RegisterMessage(int64(testDispatchMeta.ID), func(ev *Event) {
+		got = append(got, ev.Msg.(*testDispatchMsg).Value)
+	})
+
+	Handle(dispatcher, func(ses Session, msg *testDispatchMsg) {
+		got = append(got, msg.Value*10)
+	})
+
+	ev := NewEvent(Event_Recv, nil)
+	ev.MsgID = testDispatchMeta.ID
+	ev.Data = []byte(`{"Value":1}`)
+	dispatcher.Call(ev)
+
+	// 重复注册时替换
+	if len(got) != 1 || got[0] != 10 {
+		t.Fatalf("got %v, want [10]", got)
+	}
+
+	defer func() {
+		if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), "testUnregisteredMsg") {
+			t.Fatalf("panic %v does not name the prototype type", err)
+		}
+	}()
+
+	dispatcher.RegisterMessage(&testUnregisteredMsg{}, func(ev *Event) {})
+}
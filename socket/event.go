@@ -50,8 +50,61 @@ const (
 	Result_RequestClose // 请求关闭
 	Result_NextChain
 	Result_RPCTimeout
+	Result_SendQueueFull // 发送队列已满
+	Result_RateLimited   // 超过限速
+
+	Result_StopPropagation // 结束本条处理链, 并且不再投递到之后的接收处理链, 读链中使用时丢弃收到的消息
+	Result_HandlerPanic    // 处理器panic
+	Result_SkipEvent       // 处理器panic后按策略跳过的事件, 读链和写链中丢弃事件, 不断开会话
 )
 
+func (self Result) String() string {
+	switch self {
+	case Result_OK:
+		return "ok"
+	case Result_SocketError:
+		return "socketerror"
+	case Result_SocketTimeout:
+		return "sockettimeout"
+	case Result_PackageCrack:
+		return "packagecrack"
+	case Result_CodecError:
+		return "codecerror"
+	case Result_RequestClose:
+		return "requestclose"
+	case Result_NextChain:
+		return "nextchain"
+	case Result_RPCTimeout:
+		return "rpctimeout"
+	case Result_SendQueueFull:
+		return "sendqueuefull"
+	case Result_RateLimited:
+		return "ratelimited"
+	case Result_StopPropagation:
+		return "stoppropagation"
+	case Result_HandlerPanic:
+		return "handlerpanic"
+	case Result_SkipEvent:
+		return "skipevent"
+	}
+
+	return fmt.Sprintf("unknown(%d)", self)
+}
+
+// CloseReason 会话断开原因, 作为Event_Closed事件的Msg
+type CloseReason struct {
+	Result Result
+	Err    error // 引起断开的错误, 可能为nil
+}
+
+func (self CloseReason) String() string {
+	if self.Err != nil {
+		return fmt.Sprintf("%s: %s", self.Result, self.Err.Error())
+	}
+
+	return self.Result.String()
+}
+
 // 会话事件
 type Event struct {
 	UID int64
@@ -61,6 +114,7 @@ type Event struct {
 	MsgID uint32      // 消息ID
 	Msg   interface{} // 消息对象
 	Data  []byte      // 消息序列化后的数据
+	Flags uint16      // 封包头标志位
 
 	Tag         interface{} // 事件的连接, 一个处理流程后被Reset
 	TransmitTag interface{} // 接收过程可以传递到发送过程, 不会被清空
@@ -68,37 +122,143 @@ type Event struct {
 	Ses       Session       // 会话
 	ChainSend *HandlerChain // 发送handler override
 
-	r Result // 出现错误, 将结束ChainCall
+	r   Result // 出现错误, 将结束ChainCall
+	err error  // 引起错误结果的原始错误
 
 	chainid int64 // 所在链, 调试用
+
+	buf *sharedBuffer // Data所在的池化缓冲, 为nil表示Data不归事件所有
+
+	refs     int32 // 引用计数, 0表示事件不来自事件池
+	released bool  // 已归还, 调试模式下用于检查释放后使用
 }
 
+// Clone 复制事件, 与原事件共享只读的Data, 需要修改时使用MutableData
 func (self *Event) Clone() *Event {
-	c := &Event{
-		UID:         self.UID,
-		Type:        self.Type,
-		MsgID:       self.MsgID,
-		Msg:         self.Msg,
-		Tag:         self.Tag,
-		TransmitTag: self.TransmitTag,
-		Ses:         self.Ses,
-		ChainSend:   self.ChainSend,
-		Data:        make([]byte, len(self.Data)),
+	self.checkAlive()
+
+	c := acquireEvent()
+	c.UID = self.UID
+	c.Type = self.Type
+	c.MsgID = self.MsgID
+	c.Flags = self.Flags
+	c.Msg = self.Msg
+	c.Tag = self.Tag
+	c.TransmitTag = self.TransmitTag
+	c.Ses = self.Ses
+	c.ChainSend = self.ChainSend
+	c.Data = self.Data
+	c.buf = self.buf
+
+	if c.buf != nil {
+		c.buf.retain()
 	}
 
-	copy(c.Data, self.Data)
-
 	return c
 }
 
+// AllocData 从缓冲池分配size大小的Data, 归事件所有, 在Release时归还
+func (self *Event) AllocData(size int) []byte {
+	self.releaseData()
+
+	self.buf = newSharedBuffer(size)
+	self.Data = self.buf.data
+
+	return self.Data
+}
+
+// MutableData 获取可写的Data, 与其他事件共享或不归事件所有时先复制一份
+func (self *Event) MutableData() []byte {
+	if self.buf != nil && !self.buf.shared() {
+		return self.Data
+	}
+
+	data := self.Data
+
+	buf := newSharedBuffer(len(data))
+	copy(buf.data, data)
+
+	self.releaseData()
+
+	self.buf = buf
+	self.Data = buf.data
+
+	return self.Data
+}
+
+// 分配size大小的新Data, 由fn根据旧Data填充, fn返回后才归还旧Data
+func (self *Event) transformData(size int, fn func(dst, src []byte)) {
+	oldBuf, oldData := self.buf, self.Data
+
+	// 解除旧缓冲, 避免AllocData归还后被立即复用
+	self.buf = nil
+
+	fn(self.AllocData(size), oldData)
+
+	if oldBuf != nil {
+		oldBuf.release()
+	}
+}
+
+// Retain 增加引用, 需要在处理链返回后继续使用事件时调用, 用完后调用Release
+func (self *Event) Retain() {
+	self.checkAlive()
+
+	if atomic.LoadInt32(&self.refs) > 0 {
+		atomic.AddInt32(&self.refs, 1)
+	}
+}
+
+// Release 释放引用, 最后一个引用释放时归还Data占用的缓冲和事件本身, 之后不能再访问事件
+func (self *Event) Release() {
+	self.checkAlive()
+
+	// 不来自事件池的事件只归还缓冲
+	if atomic.LoadInt32(&self.refs) == 0 {
+		self.releaseData()
+		return
+	}
+
+	if atomic.AddInt32(&self.refs, -1) > 0 {
+		return
+	}
+
+	self.releaseData()
+
+	recycleEvent(self)
+}
+
+func (self *Event) releaseData() {
+	if self.buf != nil {
+		self.buf.release()
+		self.buf = nil
+	}
+
+	self.Data = nil
+}
+
 func (self *Event) Result() Result {
+	self.checkAlive()
 	return self.r
 }
 
 func (self *Event) SetResult(r Result) {
+	self.checkAlive()
 	self.r = r
 }
 
+// SetError 根据错误设置结果, 并保留原始错误用于记录断开原因
+func (self *Event) SetError(err error) {
+	self.checkAlive()
+	self.r = errToResult(err)
+	self.err = err
+}
+
+// Err 取SetError设置的原始错误
+func (self *Event) Err() error {
+	return self.err
+}
+
 func (self *Event) PeerName() string {
 	if self.Ses == nil {
 		return ""
@@ -142,13 +302,13 @@ func (self *Event) MsgString() string {
 	return ""
 }
 
+// NewEvent 从事件池分配事件, 处理完成后调用Release归还
 func NewEvent(t EventType, s Session) *Event {
-	self := &Event{
-		Type: t,
-		Ses:  s,
-	}
+	self := acquireEvent()
+	self.Type = t
+	self.Ses = s
 
-	if EnableHandlerLog {
+	if HandlerLogEnabled() {
 		self.UID = genSesEvUID()
 	}
 
@@ -2,24 +2,225 @@ package socket
 
 import (
 	"sync"
+	"time"
 )
 
+// OverflowPolicy 发送队列超限时的处理策略
+type OverflowPolicy int32
+
+const (
+	Overflow_DropNewest OverflowPolicy = iota // 丢弃新加入的事件
+	Overflow_DropOldest                       // 丢弃队列中最早的事件
+	Overflow_Block                            // 阻塞等待队列空出, 超时后丢弃新事件
+	Overflow_Close                            // 关闭会话
+)
+
+func (self OverflowPolicy) String() string {
+	switch self {
+	case Overflow_DropNewest:
+		return "dropnewest"
+	case Overflow_DropOldest:
+		return "dropoldest"
+	case Overflow_Block:
+		return "block"
+	case Overflow_Close:
+		return "close"
+	}
+
+	return "unknown"
+}
+
 type eventList struct {
 	list      []*Event
 	listGuard sync.Mutex
 	listCond  *sync.Cond
+
+	// 队列中事件数据的总字节数
+	size int
+
+	// 队列限制, 0表示不限制
+	maxLen  int
+	maxSize int
+
+	policy       OverflowPolicy
+	blockTimeout time.Duration // 阻塞策略的等待时间, 0表示一直等待
+
+	// 队列空出时通知阻塞的Add
+	spaceSignal chan struct{}
+
+	// 发送线程已退出, 不再接受事件
+	closed bool
+}
+
+// SetLimit 设置队列长度和字节数上限
+func (self *eventList) SetLimit(maxLen, maxSize int, policy OverflowPolicy, blockTimeout time.Duration) {
+	self.listGuard.Lock()
+	self.maxLen = maxLen
+	self.maxSize = maxSize
+	self.policy = policy
+	self.blockTimeout = blockTimeout
+	self.listGuard.Unlock()
+}
+
+// 调用时需要持有锁
+func (self *eventList) full(ev *Event) bool {
+	if self.maxLen > 0 && len(self.list) >= self.maxLen {
+		return true
+	}
+
+	// 单个事件超过上限时, 队列为空也允许放入, 防止永远无法发送
+	if self.maxSize > 0 && len(self.list) > 0 && self.size+ev.MsgSize() > self.maxSize {
+		return true
+	}
+
+	return false
+}
+
+// 丢弃并释放最早的一个事件, 调用时需要持有锁
+func (self *eventList) dropOldest() bool {
+	for index, ev := range self.list {
+		// 关闭标记不能丢
+		if ev == nil {
+			continue
+		}
+
+		self.size -= ev.MsgSize()
+		self.list = append(self.list[:index], self.list[index+1:]...)
+		ev.Release()
+		return true
+	}
+
+	return false
+}
+
+// Add 添加事件, nil表示关闭, 关闭标记不受队列限制
+// 队列满且事件被丢弃时返回Result_SendQueueFull, 丢弃的事件已释放
+// 发送线程已退出时返回Result_RequestClose, 事件由调用者处理
+func (self *eventList) Add(ev *Event) Result {
+	self.listGuard.Lock()
+
+	if self.closed {
+		self.listGuard.Unlock()
+		return Result_RequestClose
+	}
+
+	if ev != nil && self.full(ev) {
+
+		switch self.policy {
+		case Overflow_DropOldest:
+			for self.full(ev) && self.dropOldest() {
+			}
+		case Overflow_Block:
+			if !self.waitSpace(ev) {
+				self.listGuard.Unlock()
+				ev.Release()
+				return Result_SendQueueFull
+			}
+		default:
+			self.listGuard.Unlock()
+			ev.Release()
+			return Result_SendQueueFull
+		}
+	}
+
+	self.list = append(self.list, ev)
+	if ev != nil {
+		self.size += ev.MsgSize()
+	}
+
+	// 还有空间时, 唤醒下一个阻塞的Add
+	if self.maxLen == 0 || len(self.list) < self.maxLen {
+		self.notifySpace()
+	}
+
+	self.listGuard.Unlock()
+
+	self.listCond.Signal()
+
+	return Result_OK
 }
 
-func (self *eventList) Add(ev *Event) {
+// AddForce 添加事件, 不受队列限制, 发送线程已退出时释放事件
+func (self *eventList) AddForce(ev *Event) {
 	self.listGuard.Lock()
+
+	if self.closed {
+		self.listGuard.Unlock()
+
+		if ev != nil {
+			ev.Release()
+		}
+		return
+	}
+
 	self.list = append(self.list, ev)
+	if ev != nil {
+		self.size += ev.MsgSize()
+	}
+
 	self.listGuard.Unlock()
 
 	self.listCond.Signal()
 }
 
+// 等待队列空出, 调用时需要持有锁, 返回时仍持有锁
+func (self *eventList) waitSpace(ev *Event) bool {
+	var timeout <-chan time.Time
+	if self.blockTimeout > 0 {
+		timer := time.NewTimer(self.blockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for self.full(ev) {
+
+		if self.closed {
+			// 继续唤醒其他阻塞的Add
+			self.notifySpace()
+			return false
+		}
+
+		self.listGuard.Unlock()
+
+		select {
+		case <-self.spaceSignal:
+		case <-timeout:
+			self.listGuard.Lock()
+			return !self.full(ev)
+		}
+
+		self.listGuard.Lock()
+	}
+
+	return true
+}
+
+func (self *eventList) notifySpace() {
+	select {
+	case self.spaceSignal <- struct{}{}:
+	default:
+	}
+}
+
+// Len 队列中的事件数量
+func (self *eventList) Len() int {
+	self.listGuard.Lock()
+	defer self.listGuard.Unlock()
+
+	return len(self.list)
+}
+
+// Size 队列中事件数据的总字节数
+func (self *eventList) Size() int {
+	self.listGuard.Lock()
+	defer self.listGuard.Unlock()
+
+	return self.size
+}
+
 func (self *eventList) Reset() {
 	self.list = self.list[0:0]
+	self.size = 0
 }
 
 func (self *eventList) Pick() (ret []*Event, exit bool) {
@@ -29,28 +230,97 @@ func (self *eventList) Pick() (ret []*Event, exit bool) {
 		self.listCond.Wait()
 	}
 
-	self.listGuard.Unlock()
+	return self.pickLocked()
+}
+
+// PickTimeout 与Pick相同, 超时后队列仍为空时ok返回false
+func (self *eventList) PickTimeout(timeout time.Duration) (ret []*Event, exit bool, ok bool) {
+	var expired bool
+
+	timer := time.AfterFunc(timeout, func() {
+		self.listGuard.Lock()
+		expired = true
+		self.listGuard.Unlock()
+
+		self.listCond.Broadcast()
+	})
+	defer timer.Stop()
 
 	self.listGuard.Lock()
 
+	for len(self.list) == 0 && !expired {
+		self.listCond.Wait()
+	}
+
+	if len(self.list) == 0 {
+		self.listGuard.Unlock()
+		return nil, false, false
+	}
+
+	ret, exit = self.pickLocked()
+
+	return ret, exit, true
+}
+
+// 取出队列, 调用时需要持有锁, 返回时释放锁
+func (self *eventList) pickLocked() (ret []*Event, exit bool) {
+
 	// 复制出队列
-	for _, ev := range self.list {
+	var rest []*Event
+	for index, ev := range self.list {
 		if ev == nil {
 			exit = true
+			rest = self.list[index+1:]
 			break
 		} else {
 			ret = append(ret, ev)
 		}
 	}
 
+	// 关闭标记之后的事件留在队列中, 由markClosed取出
+	var remain []*Event
+	var remainSize int
+	for _, ev := range rest {
+		if ev != nil {
+			remain = append(remain, ev)
+			remainSize += ev.MsgSize()
+		}
+	}
+
+	self.Reset()
+	self.list = append(self.list, remain...)
+	self.size = remainSize
+
+	self.listGuard.Unlock()
+
+	self.notifySpace()
+
+	return
+}
+
+// 发送线程退出后调用, 之后不再接受事件, 返回未发送的事件, 并唤醒所有阻塞的Add
+func (self *eventList) markClosed() (rest []*Event) {
+	self.listGuard.Lock()
+	self.closed = true
+
+	for _, ev := range self.list {
+		if ev != nil {
+			rest = append(rest, ev)
+		}
+	}
+
 	self.Reset()
 	self.listGuard.Unlock()
 
+	self.notifySpace()
+
 	return
 }
 
 func NewPacketList() *eventList {
-	self := &eventList{}
+	self := &eventList{
+		spaceSignal: make(chan struct{}, 1),
+	}
 	self.listCond = sync.NewCond(&self.listGuard)
 
 	return self
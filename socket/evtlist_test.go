@@ -0,0 +1,233 @@
+package socket
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestEvent(msgID uint32, size int) *Event {
+	ev := NewEvent(Event_Send, nil)
+	ev.MsgID = msgID
+	ev.AllocData(size)
+
+	return ev
+}
+
+func pickedIDs(list []*Event) (ids []uint32) {
+	for _, ev := range list {
+		ids = append(ids, ev.MsgID)
+	}
+
+	return
+}
+
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestEventListOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxLen  int
+		maxSize int
+		policy  OverflowPolicy
+		sizes   []int
+		results []Result
+		picked  []uint32
+	}{
+		{
+			name:    "unlimited",
+			policy:  Overflow_DropNewest,
+			sizes:   []int{10, 10, 10},
+			results: []Result{Result_OK, Result_OK, Result_OK},
+			picked:  []uint32{1, 2, 3},
+		},
+		{
+			name:    "dropnewest by len",
+			maxLen:  2,
+			policy:  Overflow_DropNewest,
+			sizes:   []int{10, 10, 10},
+			results: []Result{Result_OK, Result_OK, Result_SendQueueFull},
+			picked:  []uint32{1, 2},
+		},
+		{
+			name:    "dropoldest by len",
+			maxLen:  2,
+			policy:  Overflow_DropOldest,
+			sizes:   []int{10, 10, 10},
+			results: []Result{Result_OK, Result_OK, Result_OK},
+			picked:  []uint32{2, 3},
+		},
+		{
+			name:    "dropoldest by size",
+			maxSize: 25,
+			policy:  Overflow_DropOldest,
+			sizes:   []int{10, 10, 20},
+			results: []Result{Result_OK, Result_OK, Result_OK},
+			picked:  []uint32{3},
+		},
+		{
+			name:    "close reports full",
+			maxLen:  1,
+			policy:  Overflow_Close,
+			sizes:   []int{10, 10},
+			results: []Result{Result_OK, Result_SendQueueFull},
+			picked:  []uint32{1},
+		},
+		{
+			name:    "oversized event into empty queue",
+			maxSize: 5,
+			policy:  Overflow_DropNewest,
+			sizes:   []int{10, 1},
+			results: []Result{Result_OK, Result_SendQueueFull},
+			picked:  []uint32{1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			list := NewPacketList()
+			list.SetLimit(tc.maxLen, tc.maxSize, tc.policy, 0)
+
+			for index, size := range tc.sizes {
+				if r := list.Add(newTestEvent(uint32(index+1), size)); r != tc.results[index] {
+					t.Fatalf("add %d: got %s, want %s", index+1, r, tc.results[index])
+				}
+			}
+
+			picked, exit := list.Pick()
+			if exit {
+				t.Fatal("unexpected exit")
+			}
+
+			if ids := pickedIDs(picked); !equalIDs(ids, tc.picked) {
+				t.Fatalf("picked %v, want %v", ids, tc.picked)
+			}
+
+			if list.Len() != 0 || list.Size() != 0 {
+				t.Fatalf("queue not empty after pick: len %d size %d", list.Len(), list.Size())
+			}
+		})
+	}
+}
+
+func TestEventListDropReleases(t *testing.T) {
+	EnableEventDebug = true
+	defer func() { EnableEventDebug = false }()
+
+	// 丢弃最早
+	list := NewPacketList()
+	list.SetLimit(1, 0, Overflow_DropOldest, 0)
+
+	oldest := newTestEvent(1, 10)
+	list.Add(oldest)
+	list.Add(newTestEvent(2, 10))
+
+	if !oldest.released {
+		t.Fatal("dropped oldest event not released")
+	}
+
+	// 丢弃新加入的
+	list = NewPacketList()
+	list.SetLimit(1, 0, Overflow_DropNewest, 0)
+	list.Add(newTestEvent(1, 10))
+
+	newest := newTestEvent(2, 10)
+	list.Add(newest)
+
+	if !newest.released {
+		t.Fatal("dropped newest event not released")
+	}
+
+	// 关闭后强制加入
+	list.markClosed()
+
+	forced := newTestEvent(3, 10)
+	list.AddForce(forced)
+
+	if !forced.released {
+		t.Fatal("event forced into closed list not released")
+	}
+}
+
+func TestEventListBlock(t *testing.T) {
+	list := NewPacketList()
+	list.SetLimit(1, 0, Overflow_Block, 20*time.Millisecond)
+
+	list.Add(newTestEvent(1, 10))
+
+	// 超时后丢弃
+	begin := time.Now()
+	if r := list.Add(newTestEvent(2, 10)); r != Result_SendQueueFull {
+		t.Fatalf("got %s, want %s", r, Result_SendQueueFull)
+	}
+
+	if elapsed := time.Since(begin); elapsed < 20*time.Millisecond {
+		t.Fatalf("returned after %s, before block timeout", elapsed)
+	}
+
+	// 队列空出后继续
+	list.SetLimit(1, 0, Overflow_Block, 0)
+
+	done := make(chan Result)
+
+	go func() {
+		done <- list.Add(newTestEvent(3, 10))
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	list.Pick()
+
+	select {
+	case r := <-done:
+		if r != Result_OK {
+			t.Fatalf("got %s, want %s", r, Result_OK)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked add not woken by pick")
+	}
+
+	picked, _ := list.Pick()
+	if ids := pickedIDs(picked); !equalIDs(ids, []uint32{3}) {
+		t.Fatalf("picked %v, want [3]", ids)
+	}
+}
+
+func TestEventListClose(t *testing.T) {
+	list := NewPacketList()
+	list.SetLimit(1, 0, Overflow_DropOldest, 0)
+
+	list.Add(newTestEvent(1, 10))
+	list.Add(nil)
+
+	// 关闭标记不会被丢弃
+	list.Add(newTestEvent(2, 10))
+
+	picked, exit := list.Pick()
+	if !exit {
+		t.Fatal("close marker lost")
+	}
+
+	if ids := pickedIDs(picked); len(ids) != 0 {
+		t.Fatalf("picked %v, want none", ids)
+	}
+
+	// 关闭标记之后的事件由markClosed取出
+	if ids := pickedIDs(list.markClosed()); !equalIDs(ids, []uint32{2}) {
+		t.Fatalf("rest %v, want [2]", ids)
+	}
+
+	if r := list.Add(newTestEvent(3, 10)); r != Result_RequestClose {
+		t.Fatalf("got %s, want %s", r, Result_RequestClose)
+	}
+}
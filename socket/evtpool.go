@@ -0,0 +1,40 @@
+package socket
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EnableEventDebug 开启后, 归还的事件不再复用, 再次访问时panic, 用于查找释放后使用
+var EnableEventDebug bool
+
+var eventPool = sync.Pool{
+	New: func() interface{} {
+		return new(Event)
+	},
+}
+
+func acquireEvent() *Event {
+	self := eventPool.Get().(*Event)
+	self.refs = 1
+
+	return self
+}
+
+func recycleEvent(self *Event) {
+	*self = Event{}
+
+	if EnableEventDebug {
+		// 不放回池中, 保持已释放标记
+		self.released = true
+		return
+	}
+
+	eventPool.Put(self)
+}
+
+func (self *Event) checkAlive() {
+	if EnableEventDebug && self.released {
+		panic(fmt.Sprintf("event used after release: %p", self))
+	}
+}
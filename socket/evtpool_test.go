@@ -0,0 +1,81 @@
+package socket
+
+import (
+	"testing"
+)
+
+func expectPanic(t *testing.T, name string, fn func()) {
+	t.Helper()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("%s: no panic", name)
+		}
+	}()
+
+	fn()
+}
+
+func TestEventRetainRelease(t *testing.T) {
+	EnableEventDebug = true
+	defer func() { EnableEventDebug = false }()
+
+	ev := NewEvent(Event_Recv, nil)
+	ev.AllocData(10)
+	buf := ev.buf
+
+	ev.Retain()
+	ev.Release()
+
+	if ev.released {
+		t.Fatal("event released while still referenced")
+	}
+
+	// 克隆的事件共享缓冲, 原事件释放后缓冲仍有效
+	c := ev.Clone()
+	ev.Release()
+
+	if !ev.released {
+		t.Fatal("event not released after last reference")
+	}
+
+	if buf.data == nil || &c.Data[0] != &buf.data[0] {
+		t.Fatal("shared buffer freed while clone alive")
+	}
+
+	c.Release()
+
+	if !c.released {
+		t.Fatal("clone not released")
+	}
+}
+
+func TestEventDoubleRelease(t *testing.T) {
+	EnableEventDebug = true
+	defer func() { EnableEventDebug = false }()
+
+	ev := NewEvent(Event_Recv, nil)
+	ev.Release()
+
+	expectPanic(t, "double release", ev.Release)
+	expectPanic(t, "retain after release", ev.Retain)
+	expectPanic(t, "clone after release", func() { ev.Clone() })
+}
+
+func TestEventNotFromPool(t *testing.T) {
+	EnableEventDebug = true
+	defer func() { EnableEventDebug = false }()
+
+	// 不来自事件池的事件只归还缓冲, 可以继续使用
+	ev := &Event{Type: Event_Recv}
+	ev.AllocData(10)
+	ev.Retain()
+	ev.Release()
+
+	if ev.released || ev.Data != nil || ev.buf != nil {
+		t.Fatal("event not from pool should only free its data")
+	}
+
+	ev.AllocData(10)
+	ev.Release()
+}
@@ -0,0 +1,34 @@
+package socket
+
+import (
+	"sync/atomic"
+)
+
+// 按事件类型统计投递到处理链的事件数量
+var eventCounters [Event_Send + 1]int64
+
+func countEvent(t EventType) {
+	if t >= 0 && int(t) < len(eventCounters) {
+		atomic.AddInt64(&eventCounters[t], 1)
+	}
+}
+
+// EventCount 进程启动以来, 投递到接收处理链或写出的某类事件数量
+func EventCount(t EventType) int64 {
+	if t < 0 || int(t) >= len(eventCounters) {
+		return 0
+	}
+
+	return atomic.LoadInt64(&eventCounters[t])
+}
+
+// EventCounts 所有事件类型的数量, 按类型名
+func EventCounts() map[string]int64 {
+	ret := make(map[string]int64)
+
+	for t := Event_Connected; t <= Event_Send; t++ {
+		ret[t.String()] = EventCount(t)
+	}
+
+	return ret
+}
@@ -0,0 +1,179 @@
+package socket
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// GatewayBackend 为客户端消息选择转发到的后端会话, 没有可用会话时返回nil
+type GatewayBackend func(client Session) Session
+
+// ConnectorBackend 转发到Connector的连接
+func ConnectorBackend(p Peer) GatewayBackend {
+	return func(client Session) Session {
+		return p.(Connector).DefaultSession()
+	}
+}
+
+// PoolBackend 转发到连接池, 一致性哈希时以客户端会话ID为key
+func PoolBackend(pool *ConnectorPool) GatewayBackend {
+	return func(client Session) Session {
+		return pool.Pick(strconv.FormatInt(client.ID(), 10))
+	}
+}
+
+// 按MsgID范围路由, 包含min和max
+type gatewayRoute struct {
+	minID, maxID uint32
+	backend      GatewayBackend
+}
+
+// 会话上保存绑定后端的key
+type gatewayBindKey struct{}
+
+// Gateway 网关, 在一个Acceptor上接受客户端, 将消息原样转发到后端, 后端的回复转发回客户端
+// 按会话绑定的后端或MsgID范围选择后端, 都没有时使用默认后端
+// 网关与后端之间的连接需要在读链中加入RelayReader, 写链中加入RelayWriter, 用于传递客户端会话ID
+// 后端处理消息时, ev.TransmitTag为客户端会话ID, 使用Reply回复
+type Gateway struct {
+	clients Peer
+
+	routes         []gatewayRoute
+	defaultBackend GatewayBackend
+	routesGuard    sync.RWMutex
+
+	// 找不到后端或客户端而丢弃的消息数
+	droppedCount int64
+}
+
+// AddRoute 将MsgID在[minID, maxID]范围内的消息转发到backend, 先添加的范围优先
+func (self *Gateway) AddRoute(minID, maxID uint32, backend GatewayBackend) {
+	self.routesGuard.Lock()
+	self.routes = append(self.routes, gatewayRoute{minID: minID, maxID: maxID, backend: backend})
+	self.routesGuard.Unlock()
+}
+
+// SetDefaultBackend 没有匹配的路由时使用的后端
+func (self *Gateway) SetDefaultBackend(backend GatewayBackend) {
+	self.routesGuard.Lock()
+	self.defaultBackend = backend
+	self.routesGuard.Unlock()
+}
+
+// AddBackend 接收后端连接上的回复并转发回客户端, 每个后端Connector都需要调用
+// 使用连接池时, 在创建连接池的setup函数中调用
+func (self *Gateway) AddBackend(p Peer) {
+	p.AddChainRecv(NewHandlerChain(NewMiddleware("GatewayBackend", func(ev *Event, next func()) {
+		if ev.Type == Event_Recv {
+			self.relayToClient(ev)
+		}
+
+		next()
+	})))
+}
+
+// Bind 将客户端之后的消息都转发到指定的后端会话, 优先于路由, 后端会话断开后恢复按路由转发
+func (self *Gateway) Bind(client Session, backend Session) {
+	client.(interface {
+		SetContext(key, value interface{})
+	}).SetContext(gatewayBindKey{}, backend)
+}
+
+// Unbind 解除客户端的绑定
+func (self *Gateway) Unbind(client Session) {
+	self.Bind(client, nil)
+}
+
+// DroppedCount 找不到后端或客户端而丢弃的消息数
+func (self *Gateway) DroppedCount() int64 {
+	return atomic.LoadInt64(&self.droppedCount)
+}
+
+// 绑定的后端, 会话断开时视为没有绑定
+func (self *Gateway) boundBackend(client Session) Session {
+	backend, _ := client.(interface {
+		Context(key interface{}) interface{}
+	}).Context(gatewayBindKey{}).(Session)
+
+	if backend == nil || backend.CloseReason().Result != Result_OK {
+		return nil
+	}
+
+	return backend
+}
+
+func (self *Gateway) route(client Session, msgID uint32) Session {
+	if backend := self.boundBackend(client); backend != nil {
+		return backend
+	}
+
+	self.routesGuard.RLock()
+	defer self.routesGuard.RUnlock()
+
+	for _, r := range self.routes {
+		if msgID >= r.minID && msgID <= r.maxID {
+			return r.backend(client)
+		}
+	}
+
+	if self.defaultBackend != nil {
+		return self.defaultBackend(client)
+	}
+
+	return nil
+}
+
+// 客户端消息转发到后端
+func (self *Gateway) relayToBackend(ev *Event) {
+	backend := self.route(ev.Ses, ev.MsgID)
+	if backend == nil {
+		atomic.AddInt64(&self.droppedCount, 1)
+		return
+	}
+
+	self.relay(ev, backend, ev.Ses.ID())
+}
+
+// 后端回复转发到客户端
+func (self *Gateway) relayToClient(ev *Event) {
+	clientID, _ := ev.TransmitTag.(int64)
+
+	client := self.clients.GetSession(clientID)
+	if client == nil {
+		atomic.AddInt64(&self.droppedCount, 1)
+		return
+	}
+
+	self.relay(ev, client, nil)
+}
+
+// 复制事件并发送到目标会话, 与收到的事件共享Data
+func (self *Gateway) relay(ev *Event, to Session, transmitTag interface{}) {
+	fwd := ev.Clone()
+	fwd.Type = Event_Send
+	fwd.Ses = to
+	fwd.Msg = nil
+	fwd.Tag = nil
+	fwd.TransmitTag = transmitTag
+	fwd.ChainSend = encodedChainSend
+
+	to.Send(fwd)
+}
+
+// NewGateway 创建网关, 在clients上添加转发客户端消息的接收处理链
+func NewGateway(clients Peer) *Gateway {
+	self := &Gateway{
+		clients: clients,
+	}
+
+	clients.AddChainRecv(NewHandlerChain(NewMiddleware("Gateway", func(ev *Event, next func()) {
+		if ev.Type == Event_Recv {
+			self.relayToBackend(ev)
+		}
+
+		next()
+	})))
+
+	return self
+}
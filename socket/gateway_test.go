@@ -0,0 +1,246 @@
+package socket
+
+import (
+	"testing"
+	"time"
+)
+
+// 未启动的会话, 发送的事件留在发送队列中
+func newIdleSession() *socketSession {
+	ses, _ := newPipeSessions(newFramePeer())
+	return ses
+}
+
+// 取出发送队列中的事件, 没有时返回nil
+func pickSent(ses *socketSession) []*Event {
+	list, _, _ := ses.sendList.PickTimeout(time.Millisecond)
+	return list
+}
+
+func fixedBackend(ses Session) GatewayBackend {
+	return func(client Session) Session {
+		return ses
+	}
+}
+
+func TestGatewayRoute(t *testing.T) {
+	gw := NewGateway(newFramePeer())
+
+	client := newIdleSession()
+	login, game, chat, other := newIdleSession(), newIdleSession(), newIdleSession(), newIdleSession()
+
+	gw.AddRoute(1, 99, fixedBackend(login))
+	gw.AddRoute(100, 199, fixedBackend(game))
+
+	// 与之前的范围重叠, 先添加的优先
+	gw.AddRoute(150, 299, fixedBackend(chat))
+
+	tests := []struct {
+		msgID uint32
+		want  Session
+	}{
+		{1, login},
+		{99, login},
+		{100, game},
+		{199, game},
+		{200, chat},
+		{299, chat},
+		{300, nil},
+		{0, nil},
+	}
+
+	for _, tc := range tests {
+		if backend := gw.route(client, tc.msgID); backend != tc.want {
+			t.Fatalf("msg %d routed to %v, want %v", tc.msgID, backend, tc.want)
+		}
+	}
+
+	// 没有匹配的路由时使用默认后端
+	gw.SetDefaultBackend(fixedBackend(other))
+
+	if backend := gw.route(client, 300); backend != other {
+		t.Fatalf("msg 300 routed to %v, want default", backend)
+	}
+
+	if backend := gw.route(client, 150); backend != game {
+		t.Fatalf("msg 150 routed to %v, want game", backend)
+	}
+}
+
+func TestGatewayBind(t *testing.T) {
+	gw := NewGateway(newFramePeer())
+
+	client := newIdleSession()
+	routed, bound := newIdleSession(), newIdleSession()
+
+	gw.AddRoute(1, 10, fixedBackend(routed))
+
+	// 绑定优先于路由, 包括没有匹配路由的消息
+	gw.Bind(client, bound)
+
+	for _, msgID := range []uint32{1, 100} {
+		if backend := gw.route(client, msgID); backend != bound {
+			t.Fatalf("bound msg %d routed to %v", msgID, backend)
+		}
+	}
+
+	gw.Unbind(client)
+
+	if backend := gw.route(client, 1); backend != routed {
+		t.Fatalf("unbound msg routed to %v", backend)
+	}
+
+	// 绑定的后端断开后恢复按路由转发
+	gw.Bind(client, bound)
+	bound.Close()
+
+	if backend := gw.route(client, 1); backend != routed {
+		t.Fatalf("msg routed to closed backend %v", backend)
+	}
+}
+
+func TestGatewayRelayToBackend(t *testing.T) {
+	clients := newFramePeer()
+	gw := NewGateway(clients)
+
+	client := newIdleSession()
+	client.SetID(42)
+
+	backend := newIdleSession()
+	gw.AddRoute(1, 1, fixedBackend(backend))
+
+	ev := NewEvent(Event_Recv, client)
+	ev.MsgID = 1
+	ev.Msg = "decoded"
+	copy(ev.AllocData(5), "hello")
+
+	clients.ChainListRecv().Call(ev)
+	ev.Release()
+
+	list := pickSent(backend)
+	if len(list) != 1 {
+		t.Fatalf("backend got %d events, want 1", len(list))
+	}
+
+	fwd := list[0]
+	if fwd.Type != Event_Send || fwd.Ses != backend || string(fwd.Data) != "hello" {
+		t.Fatalf("forwarded %v to %v: %q", fwd.Type, fwd.Ses, fwd.Data)
+	}
+
+	// 已编码的封包不经过后端Peer的发送处理链
+	if fwd.TransmitTag != int64(42) || fwd.Msg != nil || fwd.ChainSend != encodedChainSend {
+		t.Fatalf("forwarded tag %v msg %v", fwd.TransmitTag, fwd.Msg)
+	}
+
+	fwd.Release()
+
+	// 没有匹配的后端时丢弃
+	ev = NewEvent(Event_Recv, client)
+	ev.MsgID = 2
+	clients.ChainListRecv().Call(ev)
+	ev.Release()
+
+	if gw.DroppedCount() != 1 {
+		t.Fatalf("dropped %d, want 1", gw.DroppedCount())
+	}
+}
+
+func TestGatewayRelayToClient(t *testing.T) {
+	clients := newFramePeer()
+	gw := NewGateway(clients)
+
+	client := newIdleSession()
+	clients.(SessionManager).Add(client)
+
+	backendPeer := newFramePeer()
+	gw.AddBackend(backendPeer)
+
+	backend := newIdleSession()
+
+	ev := NewEvent(Event_Recv, backend)
+	ev.TransmitTag = client.ID()
+	copy(ev.AllocData(5), "reply")
+
+	backendPeer.ChainListRecv().Call(ev)
+	ev.Release()
+
+	list := pickSent(client)
+	if len(list) != 1 || string(list[0].Data) != "reply" || list[0].TransmitTag != nil {
+		t.Fatalf("client got %v", list)
+	}
+
+	list[0].Release()
+
+	// 客户端已经不存在
+	ev = NewEvent(Event_Recv, backend)
+	ev.TransmitTag = client.ID() + 1
+	backendPeer.ChainListRecv().Call(ev)
+	ev.Release()
+
+	if gw.DroppedCount() != 1 {
+		t.Fatalf("dropped %d, want 1", gw.DroppedCount())
+	}
+}
+
+func TestRelayPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  interface{}
+		want int64
+	}{
+		{"client id", int64(42), 42},
+		{"negative", int64(-1), -1},
+		{"no tag", nil, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ev := NewEvent(Event_Send, nil)
+			ev.TransmitTag = tc.tag
+			copy(ev.AllocData(3), "abc")
+
+			NewRelayWriter().Call(ev)
+
+			if len(ev.Data) != relayHeaderSize+3 {
+				t.Fatalf("written %d bytes", len(ev.Data))
+			}
+
+			recv := NewEvent(Event_Recv, nil)
+			copy(recv.AllocData(len(ev.Data)), ev.Data)
+			ev.Release()
+
+			NewRelayReader().Call(recv)
+
+			if recv.Result() != Result_OK || recv.TransmitTag != tc.want || string(recv.Data) != "abc" {
+				t.Fatalf("read %v %v %q", recv.Result(), recv.TransmitTag, recv.Data)
+			}
+
+			recv.Release()
+		})
+	}
+}
+
+func TestRelayReaderShortFrame(t *testing.T) {
+	for size := 0; size <= relayHeaderSize; size++ {
+		ev := NewEvent(Event_Recv, nil)
+		ev.AllocData(size)
+
+		NewRelayReader().Call(ev)
+
+		want := Result_PackageCrack
+		if size == relayHeaderSize {
+			want = Result_OK
+		}
+
+		if ev.Result() != want {
+			t.Fatalf("%d bytes: got %v, want %v", size, ev.Result(), want)
+		}
+
+		// 只有前缀的封包, 包体为空
+		if want == Result_OK && len(ev.Data) != 0 {
+			t.Fatalf("%d bytes: body %q", size, ev.Data)
+		}
+
+		ev.Release()
+	}
+}
@@ -3,19 +3,47 @@ package socket
 import (
 	"fmt"
 	"reflect"
+	"sync/atomic"
 )
 
 type EventHandler interface {
 	Call(*Event)
 }
 
+// EnableHandlerLog 开启处理器日志, 与SetHandlerLog任一开启时输出
+// Deprecated: 运行时修改不是并发安全的, 使用SetHandlerLog
 var EnableHandlerLog bool
 
+// 处理器日志开关, 可在运行时修改
+var enableHandlerLog int32
+
+// SetHandlerLog 开关处理器日志
+func SetHandlerLog(enable bool) {
+	var v int32
+	if enable {
+		v = 1
+	}
+
+	atomic.StoreInt32(&enableHandlerLog, v)
+}
+
+// HandlerLogEnabled 处理器日志是否开启
+func HandlerLogEnabled() bool {
+	return atomic.LoadInt32(&enableHandlerLog) != 0 || EnableHandlerLog
+}
+
+// HandlerName 处理器名字, 用于查找和日志, 实现HandlerName() string时使用自定义名字, 否则为类型名
 func HandlerName(h EventHandler) string {
 	if h == nil {
 		return "nil"
 	}
 
+	if named, ok := h.(interface {
+		HandlerName() string
+	}); ok {
+		return named.HandlerName()
+	}
+
 	return reflect.TypeOf(h).Elem().Name()
 }
 
@@ -27,8 +55,10 @@ func HandlerString(h EventHandler) string {
 	}
 }
 
+// HandlerLog 开启处理器日志时, 输出每个处理器的调用
 func HandlerLog(h EventHandler, ev *Event) {
-	if EnableHandlerLog {
+	if HandlerLogEnabled() {
+		fmt.Printf("#handler chain: %d evuid: %d %s ses: %d -> %s\n", ev.chainid, ev.UID, ev.Type, ev.SessionID(), HandlerName(h))
 	}
 }
 
@@ -0,0 +1,73 @@
+package socket
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// 包体前附加: 序号(uint32) + CRC32(uint32), 小端, CRC32覆盖序号和包体
+const checksumHeaderSize = 8
+
+// ChecksumWriter 为发送的包体附加递增序号和CRC32, 放在写链的封包写入之前
+type ChecksumWriter struct {
+	seq uint32
+}
+
+func (self *ChecksumWriter) Call(ev *Event) {
+	self.seq++
+
+	ev.transformData(checksumHeaderSize+len(ev.Data), func(dst, src []byte) {
+		binary.LittleEndian.PutUint32(dst[0:], self.seq)
+		copy(dst[checksumHeaderSize:], src)
+
+		binary.LittleEndian.PutUint32(dst[4:], checksum(dst))
+	})
+}
+
+func NewChecksumWriter() EventHandler {
+	return &ChecksumWriter{}
+}
+
+// ChecksumReader 校验包体的CRC32和序号, 序号必须连续递增, 否则视为封包破损或重放
+// 放在读链的封包读取之后
+type ChecksumReader struct {
+	seq uint32
+}
+
+func (self *ChecksumReader) Call(ev *Event) {
+	if ev.Type != Event_Recv {
+		return
+	}
+
+	if len(ev.Data) < checksumHeaderSize {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	if binary.LittleEndian.Uint32(ev.Data[4:]) != checksum(ev.Data) {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	seq := binary.LittleEndian.Uint32(ev.Data[0:])
+
+	// 序号回绕后从0继续
+	if seq != self.seq+1 {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	self.seq = seq
+
+	ev.Data = ev.Data[checksumHeaderSize:]
+}
+
+func NewChecksumReader() EventHandler {
+	return &ChecksumReader{}
+}
+
+// 计算序号和包体的CRC32, 跳过CRC32字段本身
+func checksum(pkt []byte) uint32 {
+	crc := crc32.ChecksumIEEE(pkt[0:4])
+	return crc32.Update(crc, crc32.IEEETable, pkt[checksumHeaderSize:])
+}
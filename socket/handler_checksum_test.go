@@ -0,0 +1,99 @@
+package socket
+
+import (
+	"testing"
+)
+
+// 经过ChecksumWriter的封包数据
+func checksumFrames(list ...string) (frames [][]byte) {
+	writer := NewChecksumWriter()
+
+	for _, data := range list {
+		ev := NewEvent(Event_Send, nil)
+		copy(ev.AllocData(len(data)), data)
+
+		writer.Call(ev)
+
+		frames = append(frames, append([]byte(nil), ev.Data...))
+		ev.Release()
+	}
+
+	return
+}
+
+// 依次交给同一个ChecksumReader, 返回每个封包的结果
+func checksumRead(frames ...[]byte) (results []Result, data []string) {
+	reader := NewChecksumReader()
+
+	for _, frame := range frames {
+		ev := NewEvent(Event_Recv, nil)
+		copy(ev.AllocData(len(frame)), frame)
+
+		reader.Call(ev)
+
+		results = append(results, ev.Result())
+		data = append(data, string(ev.Data))
+		ev.Release()
+	}
+
+	return
+}
+
+func TestChecksumRoundTrip(t *testing.T) {
+	frames := checksumFrames("hello", "", "world")
+
+	results, data := checksumRead(frames...)
+
+	for index, want := range []string{"hello", "", "world"} {
+		if results[index] != Result_OK || data[index] != want {
+			t.Fatalf("frame %d: got %v %q, want %q", index, results[index], data[index], want)
+		}
+	}
+}
+
+func TestChecksumReject(t *testing.T) {
+	frames := checksumFrames("a", "b", "c")
+
+	tampered := append([]byte(nil), frames[0]...)
+	tampered[len(tampered)-1] ^= 1
+
+	badSeq := append([]byte(nil), frames[0]...)
+	badSeq[0] ^= 1
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"tampered body", [][]byte{tampered}},
+		{"tampered seq", [][]byte{badSeq}},
+		{"short frame", [][]byte{frames[0][:checksumHeaderSize-1]}},
+		{"replayed", [][]byte{frames[0], frames[1], frames[1]}},
+		{"skipped", [][]byte{frames[0], frames[2]}},
+		{"out of order", [][]byte{frames[1]}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			results, _ := checksumRead(tc.frames...)
+
+			for index, r := range results[:len(results)-1] {
+				if r != Result_OK {
+					t.Fatalf("frame %d before rejected one: %v", index, r)
+				}
+			}
+
+			if r := results[len(results)-1]; r != Result_PackageCrack {
+				t.Fatalf("got %v, want %v", r, Result_PackageCrack)
+			}
+		})
+	}
+}
+
+func TestChecksumSkipsSystemEvents(t *testing.T) {
+	ev := NewEvent(Event_Accepted, nil)
+	NewChecksumReader().Call(ev)
+
+	if ev.Result() != Result_OK {
+		t.Fatalf("system event: %v", ev.Result())
+	}
+}
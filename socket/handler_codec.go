@@ -0,0 +1,34 @@
+package socket
+
+// MessageEncoder 将ev.Msg编码为Data并填充MsgID, 放在发送处理链中
+// Data已存在或Msg为nil时不处理
+type MessageEncoder struct {
+	codec Codec
+}
+
+func (self *MessageEncoder) Call(ev *Event) {
+	if ev.Msg == nil || ev.Data != nil {
+		return
+	}
+
+	meta := MessageMetaByMsg(ev.Msg)
+	if meta == nil {
+		ev.SetResult(Result_CodecError)
+		return
+	}
+
+	data, err := self.codec.Encode(ev.Msg)
+	if err != nil {
+		ev.SetResult(Result_CodecError)
+		return
+	}
+
+	ev.MsgID = meta.ID
+	ev.Data = data
+}
+
+func NewMessageEncoder(codec Codec) EventHandler {
+	return &MessageEncoder{
+		codec: codec,
+	}
+}
@@ -0,0 +1,120 @@
+package socket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+)
+
+// CompressWriter 包体超过阈值时压缩, 并在封包头标记FrameFlag_Compressed
+// 放在写链的封包写入之前, 需要配合带标志位的封包格式, 如LengthFrameWriter
+type CompressWriter struct {
+	threshold int
+
+	level  int
+	writer *flate.Writer
+	buff   bytes.Buffer
+}
+
+func (self *CompressWriter) Call(ev *Event) {
+	if len(ev.Data) < self.threshold || ev.Flags&FrameFlag_Compressed != 0 {
+		return
+	}
+
+	self.buff.Reset()
+
+	if self.writer == nil {
+		w, err := flate.NewWriter(&self.buff, self.level)
+		if err != nil {
+			ev.SetResult(Result_CodecError)
+			return
+		}
+
+		self.writer = w
+	} else {
+		self.writer.Reset(&self.buff)
+	}
+
+	if _, err := self.writer.Write(ev.Data); err != nil {
+		ev.SetResult(Result_CodecError)
+		return
+	}
+
+	if err := self.writer.Close(); err != nil {
+		ev.SetResult(Result_CodecError)
+		return
+	}
+
+	// 压缩后没有变小, 原样发送
+	if self.buff.Len() >= len(ev.Data) {
+		return
+	}
+
+	ev.AllocData(self.buff.Len())
+	copy(ev.Data, self.buff.Bytes())
+
+	ev.Flags |= FrameFlag_Compressed
+}
+
+// NewCompressWriter 创建压缩处理, threshold为压缩的最小包体大小, level参见compress/flate
+func NewCompressWriter(threshold, level int) EventHandler {
+	return &CompressWriter{
+		threshold: threshold,
+		level:     level,
+	}
+}
+
+// DecompressReader 解压标记了FrameFlag_Compressed的包体, 放在读链的封包读取之后
+type DecompressReader struct {
+	maxSize int
+
+	reader io.ReadCloser
+	buff   bytes.Buffer
+}
+
+func (self *DecompressReader) Call(ev *Event) {
+	if ev.Flags&FrameFlag_Compressed == 0 {
+		return
+	}
+
+	if self.reader == nil {
+		self.reader = flate.NewReader(bytes.NewReader(ev.Data))
+	} else if err := self.reader.(flate.Resetter).Reset(bytes.NewReader(ev.Data), nil); err != nil {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	var src io.Reader = self.reader
+
+	// 限制解压后的大小, 防止压缩炸弹
+	maxSize := self.maxSize
+	if maxSize == 0 {
+		maxSize = sessionMaxPacketSize(ev.Ses)
+	}
+
+	src = io.LimitReader(src, int64(maxSize)+1)
+
+	self.buff.Reset()
+
+	if _, err := self.buff.ReadFrom(src); err != nil {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	if self.buff.Len() > maxSize {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	ev.AllocData(self.buff.Len())
+	copy(ev.Data, self.buff.Bytes())
+
+	ev.Flags &^= FrameFlag_Compressed
+}
+
+// NewDecompressReader 创建解压处理, maxSize为解压后的最大包体大小, 0表示使用Peer的MaxPacketSize, 也没有设置时为16M
+func NewDecompressReader(maxSize int) EventHandler {
+	return &DecompressReader{
+		maxSize: maxSize,
+	}
+}
@@ -0,0 +1,203 @@
+package socket
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// 握手时交换的X25519公钥长度
+const cryptoPublicKeySize = 32
+
+// 握手超时
+const cryptoHandshakeTimeout = 10 * time.Second
+
+// 会话上保存加密状态的key
+type cryptoContextKey struct{}
+
+// 每个方向独立的密钥和nonce计数
+type cryptoStream struct {
+	aead  cipher.AEAD
+	nonce [12]byte
+	count uint64
+}
+
+func (self *cryptoStream) nextNonce() []byte {
+	binary.BigEndian.PutUint64(self.nonce[4:], self.count)
+	self.count++
+	return self.nonce[:]
+}
+
+// 封包头中的MsgID和Flags作为附加数据, 与包体一起认证, 修改后无法解密
+func cryptoAdditionalData(ev *Event) []byte {
+	var ad [6]byte
+	binary.LittleEndian.PutUint32(ad[0:], ev.MsgID)
+	binary.LittleEndian.PutUint16(ad[4:], ev.Flags)
+	return ad[:]
+}
+
+type cryptoState struct {
+	send cryptoStream
+	recv cryptoStream
+}
+
+// CryptoReader 连接建立时进行X25519密钥交换, 之后解密收到的包体, 同时校验MsgID和Flags
+// 放在读链的封包读取之后, 修改Flags的处理器(如DecompressReader)之前, 与写链中的CryptoWriter配合使用
+type CryptoReader struct {
+	state *cryptoState
+}
+
+func (self *CryptoReader) Call(ev *Event) {
+	switch ev.Type {
+	case Event_Accepted, Event_Connected:
+		state, err := cryptoHandshake(ev.Ses, ev.Type == Event_Accepted)
+		if err != nil {
+			ev.SetError(err)
+			return
+		}
+
+		self.state = state
+
+		ev.Ses.(interface {
+			SetContext(key, value interface{})
+		}).SetContext(cryptoContextKey{}, state)
+
+	case Event_Recv:
+		if self.state == nil {
+			ev.SetResult(Result_PackageCrack)
+			return
+		}
+
+		stream := &self.state.recv
+
+		if len(ev.Data) < stream.aead.Overhead() {
+			ev.SetResult(Result_PackageCrack)
+			return
+		}
+
+		var err error
+		ev.transformData(len(ev.Data)-stream.aead.Overhead(), func(dst, src []byte) {
+			_, err = stream.aead.Open(dst[:0], stream.nextNonce(), src, cryptoAdditionalData(ev))
+		})
+
+		// 包体或封包头被篡改, 重放或乱序的封包都无法解密
+		if err != nil {
+			ev.SetResult(Result_PackageCrack)
+		}
+	}
+}
+
+func NewCryptoReader() EventHandler {
+	return &CryptoReader{}
+}
+
+// CryptoWriter 加密发送的包体, 放在写链的封包写入之前, 修改Flags的处理器(如CompressWriter)之后
+type CryptoWriter struct {
+	state *cryptoState
+}
+
+func (self *CryptoWriter) Call(ev *Event) {
+	if self.state == nil {
+		state, _ := ev.Ses.(interface {
+			Context(key interface{}) interface{}
+		}).Context(cryptoContextKey{}).(*cryptoState)
+
+		// 读链中没有完成握手
+		if state == nil {
+			ev.SetResult(Result_CodecError)
+			return
+		}
+
+		self.state = state
+	}
+
+	stream := &self.state.send
+
+	ev.transformData(len(ev.Data)+stream.aead.Overhead(), func(dst, src []byte) {
+		stream.aead.Seal(dst[:0], stream.nextNonce(), src, cryptoAdditionalData(ev))
+	})
+}
+
+func NewCryptoWriter() EventHandler {
+	return &CryptoWriter{}
+}
+
+// 双方交换公钥, 按方向派生AES-256-GCM密钥
+func cryptoHandshake(ses Session, isServer bool) (*cryptoState, error) {
+	conn := ses.RawConn().(net.Conn)
+
+	conn.SetDeadline(time.Now().Add(cryptoHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	localPub := priv.PublicKey().Bytes()
+
+	if err := writeFull(conn, localPub); err != nil {
+		return nil, err
+	}
+
+	remotePub := make([]byte, cryptoPublicKeySize)
+	if _, err := io.ReadFull(conn, remotePub); err != nil {
+		return nil, err
+	}
+
+	pub, err := ecdh.X25519().NewPublicKey(remotePub)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	clientPub, serverPub := localPub, remotePub
+	if isServer {
+		clientPub, serverPub = remotePub, localPub
+	}
+
+	c2s, err := newCryptoAEAD("c2s", shared, clientPub, serverPub)
+	if err != nil {
+		return nil, err
+	}
+
+	s2c, err := newCryptoAEAD("s2c", shared, clientPub, serverPub)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &cryptoState{}
+
+	if isServer {
+		state.send.aead, state.recv.aead = s2c, c2s
+	} else {
+		state.send.aead, state.recv.aead = c2s, s2c
+	}
+
+	return state, nil
+}
+
+func newCryptoAEAD(label string, shared, clientPub, serverPub []byte) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write([]byte(label))
+	h.Write(shared)
+	h.Write(clientPub)
+	h.Write(serverPub)
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,158 @@
+package socket
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// 握手时双方先写出公钥, 内存管道没有缓冲, 使用本地TCP连接
+func newTCPSessions(t *testing.T, p Peer) (a, b *socketSession) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	cb, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newSession(ca, p), newSession(cb, p)
+}
+
+// 完成握手的两端, a为服务器端
+func newCryptoPair(t *testing.T) (writer, reader EventHandler, a, b *socketSession) {
+	t.Helper()
+
+	a, b = newTCPSessions(t, NewAcceptor())
+
+	readerA, readerB := NewCryptoReader(), NewCryptoReader()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	var evA, evB *Event
+
+	go func() {
+		defer wg.Done()
+		evA = NewEvent(Event_Accepted, a)
+		readerA.Call(evA)
+	}()
+
+	go func() {
+		defer wg.Done()
+		evB = NewEvent(Event_Connected, b)
+		readerB.Call(evB)
+	}()
+
+	wg.Wait()
+
+	if evA.Result() != Result_OK || evB.Result() != Result_OK {
+		t.Fatalf("handshake: %s %s", evA.Result(), evB.Result())
+	}
+
+	evA.Release()
+	evB.Release()
+
+	return NewCryptoWriter(), readerB, a, b
+}
+
+// 由a加密后交给b解密, tamper在解密前修改封包
+func cryptoTransfer(writer, reader EventHandler, a, b *socketSession, msgID uint32, flags uint16, data string, tamper func(ev *Event)) (Result, string) {
+	ev := NewEvent(Event_Send, a)
+	ev.MsgID = msgID
+	ev.Flags = flags
+	copy(ev.AllocData(len(data)), data)
+
+	writer.Call(ev)
+
+	recv := NewEvent(Event_Recv, b)
+	recv.MsgID = ev.MsgID
+	recv.Flags = ev.Flags
+	copy(recv.AllocData(len(ev.Data)), ev.Data)
+	ev.Release()
+
+	if tamper != nil {
+		tamper(recv)
+	}
+
+	reader.Call(recv)
+
+	defer recv.Release()
+
+	return recv.Result(), string(recv.Data)
+}
+
+func TestCryptoRoundTrip(t *testing.T) {
+	writer, reader, a, b := newCryptoPair(t)
+	defer a.conn.Close()
+	defer b.conn.Close()
+
+	for _, data := range []string{"hello", "", "world"} {
+		if r, got := cryptoTransfer(writer, reader, a, b, 1, FrameFlag_Compressed, data, nil); r != Result_OK || got != data {
+			t.Fatalf("got %s %q, want %q", r, got, data)
+		}
+	}
+}
+
+func TestCryptoTamper(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(ev *Event)
+	}{
+		{"ciphertext", func(ev *Event) { ev.MutableData()[0] ^= 1 }},
+		{"tag", func(ev *Event) { data := ev.MutableData(); data[len(data)-1] ^= 1 }},
+		{"msgid", func(ev *Event) { ev.MsgID++ }},
+		{"flags", func(ev *Event) { ev.Flags ^= FrameFlag_Compressed }},
+		{"short", func(ev *Event) { ev.Data = ev.Data[:3] }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			writer, reader, a, b := newCryptoPair(t)
+			defer a.conn.Close()
+			defer b.conn.Close()
+
+			if r, _ := cryptoTransfer(writer, reader, a, b, 1, 0, "hello", tc.tamper); r != Result_PackageCrack {
+				t.Fatalf("got %s, want %s", r, Result_PackageCrack)
+			}
+		})
+	}
+}
+
+func TestCryptoReplay(t *testing.T) {
+	writer, reader, a, b := newCryptoPair(t)
+	defer a.conn.Close()
+	defer b.conn.Close()
+
+	ev := NewEvent(Event_Send, a)
+	copy(ev.AllocData(5), "hello")
+	writer.Call(ev)
+
+	frame := append([]byte(nil), ev.Data...)
+	ev.Release()
+
+	// 同一封包第二次收到时nonce不同, 无法解密
+	for index, want := range []Result{Result_OK, Result_PackageCrack} {
+		recv := NewEvent(Event_Recv, b)
+		copy(recv.AllocData(len(frame)), frame)
+
+		reader.Call(recv)
+
+		if recv.Result() != want {
+			t.Fatalf("frame %d: got %s, want %s", index, recv.Result(), want)
+		}
+
+		recv.Release()
+	}
+}
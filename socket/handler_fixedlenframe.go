@@ -2,37 +2,38 @@ package socket
 
 import (
 	"io"
-	"sync"
 )
 
 type FixedLengthFrameReader struct {
-	headerBuffer []byte
+	size int
 }
 
 func (self *FixedLengthFrameReader) Call(ev *Event) {
+	// 系统事件不读取封包
+	if ev.Type != Event_Recv {
+		return
+	}
+
 	reader := ev.Ses.(interface {
 		DataSource() io.ReadWriter
 	}).DataSource()
 
-	_, err := io.ReadFull(reader, self.headerBuffer)
+	// 每个事件持有自己的缓冲, 不与之后读取的封包共享
+	_, err := io.ReadFull(reader, ev.AllocData(self.size))
 
 	if err != nil {
-		ev.SetResult(Result_SocketError)
+		ev.SetError(err)
 		return
 	}
-
-	ev.Data = self.headerBuffer
 }
 
 func NewFixedLengthFrameReader(size int) EventHandler {
 	return &FixedLengthFrameReader{
-		headerBuffer: make([]byte, size),
+		size: size,
 	}
 }
 
 type FixedLengthFrameWriter struct {
-	sendser      uint16
-	sendtagGuard sync.RWMutex
 }
 
 func (self *FixedLengthFrameWriter) Call(ev *Event) {
@@ -43,27 +44,21 @@ func (self *FixedLengthFrameWriter) Call(ev *Event) {
 	err := writeFull(writer, ev.Data)
 
 	if err != nil {
-		ev.SetResult(Result_PackageCrack)
+		ev.SetError(err)
 		return
 	}
 }
 
-// 完整发送所有封包
+// 完整发送所有封包, 不修改p, p可能与其他事件共享
 func writeFull(writer io.ReadWriter, p []byte) error {
-	sizeToWrite := len(p)
-	for {
+	for len(p) > 0 {
 		n, err := writer.Write(p)
 
 		if err != nil {
 			return err
 		}
 
-		if n >= sizeToWrite {
-			break
-		}
-
-		copy(p[0:sizeToWrite-n], p[n:sizeToWrite])
-		sizeToWrite -= n
+		p = p[n:]
 	}
 	return nil
 }
@@ -0,0 +1,99 @@
+package socket
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// 封包头: 包体长度(uint32) + 消息ID(uint32) + 标志位(uint16), 小端
+const lengthFrameHeaderSize = 10
+
+// Peer没有设置最大包大小时使用的上限, 防止按封包头中的长度分配过大的内存
+const defaultMaxPacketSize = 16 * 1024 * 1024
+
+// 会话允许的最大包体大小
+func sessionMaxPacketSize(ses Session) int {
+	if maxSize := ses.FromPeer().(SocketOptions).MaxPacketSize(); maxSize > 0 {
+		return maxSize
+	}
+
+	return defaultMaxPacketSize
+}
+
+// 封包头标志位
+const (
+	FrameFlag_Compressed uint16 = 1 << iota // 包体已压缩
+	FrameFlag_ResumeAck                     // 可恢复会话的确认, 包体为已收到的序号
+)
+
+// LengthFrameReader 读取带长度头的封包, 填充MsgID, Flags和Data
+type LengthFrameReader struct {
+	header [lengthFrameHeaderSize]byte
+}
+
+func (self *LengthFrameReader) Call(ev *Event) {
+	// 系统事件不读取封包
+	if ev.Type != Event_Recv {
+		return
+	}
+
+	reader := ev.Ses.(interface {
+		DataSource() io.ReadWriter
+	}).DataSource()
+
+	if _, err := io.ReadFull(reader, self.header[:]); err != nil {
+		ev.SetError(err)
+		return
+	}
+
+	size := binary.LittleEndian.Uint32(self.header[0:])
+
+	// 超过最大包大小, 视为封包破损, 在分配内存前检查
+	if int64(size) > int64(sessionMaxPacketSize(ev.Ses)) {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	ev.MsgID = binary.LittleEndian.Uint32(self.header[4:])
+	ev.Flags = binary.LittleEndian.Uint16(self.header[8:])
+
+	if _, err := io.ReadFull(reader, ev.AllocData(int(size))); err != nil {
+		ev.SetError(err)
+		return
+	}
+}
+
+func NewLengthFrameReader() EventHandler {
+	return &LengthFrameReader{}
+}
+
+// LengthFrameWriter 写入带长度头的封包
+type LengthFrameWriter struct {
+}
+
+func (self *LengthFrameWriter) Call(ev *Event) {
+	writer := ev.Ses.(interface {
+		DataSource() io.ReadWriter
+	}).DataSource()
+
+	// 封包头和包体合并后一次写出
+	pkt := AllocBuffer(lengthFrameHeaderSize + len(ev.Data))
+
+	binary.LittleEndian.PutUint32(pkt[0:], uint32(len(ev.Data)))
+	binary.LittleEndian.PutUint32(pkt[4:], ev.MsgID)
+	binary.LittleEndian.PutUint16(pkt[8:], ev.Flags)
+	copy(pkt[lengthFrameHeaderSize:], ev.Data)
+
+	err := writeFull(writer, pkt)
+
+	FreeBuffer(pkt)
+
+	if err != nil {
+		ev.SetError(err)
+		return
+	}
+}
+
+func NewLengthFrameWriter() EventHandler {
+	return &LengthFrameWriter{}
+}
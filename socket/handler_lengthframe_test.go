@@ -0,0 +1,92 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestLengthFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		msgID uint32
+		flags uint16
+		data  []byte
+	}{
+		{1, 0, []byte("hello")},
+		{2, FrameFlag_Compressed, []byte("compressed")},
+		{3, FrameFlag_Compressed | FrameFlag_ResumeAck, []byte{1, 2, 3}},
+		{0xFFFFFFFF, 0xFFFF, nil},
+	}
+
+	a, b := newPipeSessions(NewAcceptor())
+	defer a.conn.Close()
+	defer b.conn.Close()
+
+	writer := NewLengthFrameWriter()
+	reader := NewLengthFrameReader()
+
+	for _, tc := range tests {
+		go func(msgID uint32, flags uint16, data []byte) {
+			ev := NewEvent(Event_Send, a)
+			ev.MsgID = msgID
+			ev.Flags = flags
+			ev.Data = data
+			writer.Call(ev)
+			ev.Release()
+		}(tc.msgID, tc.flags, tc.data)
+
+		ev := NewEvent(Event_Recv, b)
+		reader.Call(ev)
+
+		if ev.Result() != Result_OK {
+			t.Fatalf("msgid %d: read result %s", tc.msgID, ev.Result())
+		}
+
+		if ev.MsgID != tc.msgID || ev.Flags != tc.flags || !bytes.Equal(ev.Data, tc.data) {
+			t.Fatalf("got msgid %d flags %d data %v, want msgid %d flags %d data %v", ev.MsgID, ev.Flags, ev.Data, tc.msgID, tc.flags, tc.data)
+		}
+
+		ev.Release()
+	}
+}
+
+func TestLengthFrameMaxSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		size    uint32
+	}{
+		{"peer limit", 16, 17},
+		{"default limit", 0, defaultMaxPacketSize + 1},
+		{"huge length", 0, 0xFFFFFFFF},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewAcceptor()
+			p.(SocketOptions).SetMaxPacketSize(tc.maxSize)
+
+			a, b := newPipeSessions(p)
+			defer a.conn.Close()
+			defer b.conn.Close()
+
+			// 只写封包头, 超限时读取方不应等待包体
+			go func() {
+				var header [lengthFrameHeaderSize]byte
+				binary.LittleEndian.PutUint32(header[0:], tc.size)
+				a.conn.Write(header[:])
+			}()
+
+			ev := NewEvent(Event_Recv, b)
+			NewLengthFrameReader().Call(ev)
+
+			if ev.Result() != Result_PackageCrack {
+				t.Fatalf("got %s, want %s", ev.Result(), Result_PackageCrack)
+			}
+
+			if ev.Data != nil {
+				t.Fatal("data allocated for oversized frame")
+			}
+		})
+	}
+}
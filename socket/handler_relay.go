@@ -0,0 +1,61 @@
+package socket
+
+import (
+	"encoding/binary"
+)
+
+// 网关与后端之间的包体前附加客户端会话ID(uint64), 小端
+const relayHeaderSize = 8
+
+// RelayReader 取出包体前的客户端会话ID, 保存在ev.TransmitTag(int64)
+// 网关的后端连接和后端服务的接收连接都需要, 放在读链的封包读取之后
+type RelayReader struct {
+}
+
+func (self *RelayReader) Call(ev *Event) {
+	if ev.Type != Event_Recv {
+		return
+	}
+
+	if len(ev.Data) < relayHeaderSize {
+		ev.SetResult(Result_PackageCrack)
+		return
+	}
+
+	ev.TransmitTag = int64(binary.LittleEndian.Uint64(ev.Data))
+
+	ev.Data = ev.Data[relayHeaderSize:]
+}
+
+func NewRelayReader() EventHandler {
+	return &RelayReader{}
+}
+
+// RelayWriter 在包体前附加ev.TransmitTag中的客户端会话ID, 没有时为0
+// 放在写链的封包写入之前
+type RelayWriter struct {
+}
+
+func (self *RelayWriter) Call(ev *Event) {
+	clientID, _ := ev.TransmitTag.(int64)
+
+	ev.transformData(relayHeaderSize+len(ev.Data), func(dst, src []byte) {
+		binary.LittleEndian.PutUint64(dst, uint64(clientID))
+		copy(dst[relayHeaderSize:], src)
+	})
+}
+
+func NewRelayWriter() EventHandler {
+	return &RelayWriter{}
+}
+
+// Reply 回复收到的消息, 经过网关转发的消息会回到原客户端
+func Reply(ev *Event, msg interface{}) {
+	reply := ev.Ses.(interface {
+		newSendEvent(data interface{}) *Event
+	}).newSendEvent(msg)
+
+	reply.TransmitTag = ev.TransmitTag
+
+	ev.Ses.Send(reply)
+}
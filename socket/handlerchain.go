@@ -4,22 +4,54 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sync"
 	"sync/atomic"
 )
 
+// HandlerChain 处理链, 修改时复制一份新的列表再原子替换, 正在执行的Call不受影响
 type HandlerChain struct {
-	id   int64
-	list []EventHandler
+	id int64
+
+	list      atomic.Value // []EventHandler
+	listGuard sync.Mutex   // 修改之间互斥
+
+	panicPolicy int32 // PanicPolicy
+}
+
+// SetPanicPolicy 设置处理器panic时的处理, 默认使用会话的策略(SocketOptions.SetPanicPolicy)
+func (self *HandlerChain) SetPanicPolicy(policy PanicPolicy) {
+	atomic.StoreInt32(&self.panicPolicy, int32(policy))
+}
+
+func (self *HandlerChain) handlers() []EventHandler {
+	list, _ := self.list.Load().([]EventHandler)
+	return list
+}
+
+// 复制当前列表, 由modify修改后替换
+func (self *HandlerChain) update(modify func(list []EventHandler) []EventHandler) {
+	self.listGuard.Lock()
+
+	old := self.handlers()
+
+	list := make([]EventHandler, len(old), len(old)+1)
+	copy(list, old)
+
+	self.list.Store(modify(list))
+
+	self.listGuard.Unlock()
 }
 
 // Add 添加1个
 func (self *HandlerChain) Add(h EventHandler) {
-	self.list = append(self.list, h)
+	self.AddBatch(h)
 }
 
 // AddBatch 添加多个
 func (self *HandlerChain) AddBatch(h ...EventHandler) {
-	self.list = append(self.list, h...)
+	self.update(func(list []EventHandler) []EventHandler {
+		return append(list, h...)
+	})
 }
 
 // AddAny 启动匹配类型
@@ -29,20 +61,91 @@ func (self *HandlerChain) AddAny(objlist ...interface{}) {
 		switch v := obj.(type) {
 		case EventHandler:
 			self.Add(v)
+		case MiddlewareFunc:
+			self.Add(NewMiddleware("", v))
+		case func(ev *Event, next func()):
+			self.Add(NewMiddleware("", v))
 		case []EventHandler:
-			self.list = append(self.list, v...)
+			self.AddBatch(v...)
 		default:
 			panic("unknown hander chain input type: " + reflect.ValueOf(v).String())
 		}
 	}
 }
 
+// 按HandlerName查找, 没有返回-1
+func indexHandler(list []EventHandler, name string) int {
+	for index, h := range list {
+		if HandlerName(h) == name {
+			return index
+		}
+	}
+
+	return -1
+}
+
+func insertHandlers(list []EventHandler, index int, h []EventHandler) []EventHandler {
+	ret := make([]EventHandler, 0, len(list)+len(h))
+	ret = append(ret, list[:index]...)
+	ret = append(ret, h...)
+	return append(ret, list[index:]...)
+}
+
+// InsertBefore 在第一个名为name的处理器前插入, 找不到时返回false
+func (self *HandlerChain) InsertBefore(name string, h ...EventHandler) (ok bool) {
+	self.update(func(list []EventHandler) []EventHandler {
+		index := indexHandler(list, name)
+		if index == -1 {
+			return list
+		}
+
+		ok = true
+		return insertHandlers(list, index, h)
+	})
+
+	return
+}
+
+// InsertAfter 在第一个名为name的处理器后插入, 找不到时返回false
+func (self *HandlerChain) InsertAfter(name string, h ...EventHandler) (ok bool) {
+	self.update(func(list []EventHandler) []EventHandler {
+		index := indexHandler(list, name)
+		if index == -1 {
+			return list
+		}
+
+		ok = true
+		return insertHandlers(list, index+1, h)
+	})
+
+	return
+}
+
+// Remove 移除第一个名为name的处理器, 找不到时返回false
+func (self *HandlerChain) Remove(name string) (ok bool) {
+	self.update(func(list []EventHandler) []EventHandler {
+		index := indexHandler(list, name)
+		if index == -1 {
+			return list
+		}
+
+		ok = true
+		return append(list[:index], list[index+1:]...)
+	})
+
+	return
+}
+
 func (self *HandlerChain) String() string {
+	if self == nil {
+		return "	 nil"
+	}
+
 	var buff bytes.Buffer
 
 	buff.WriteString(fmt.Sprintf("	 chain: %d ", self.id))
 
-	for index, h := range self.list {
+	for index, h := range self.handlers() {
 
 		if index > 0 {
 			buff.WriteString(" -> ")
@@ -55,13 +158,56 @@ func (self *HandlerChain) String() string {
 }
 
 func (self *HandlerChain) Call(ev *Event) {
+	self.callWithPolicy(ev, Panic_Crash)
+}
+
+// 按策略调用, 处理链设置了策略时优先使用处理链的策略
+func (self *HandlerChain) callWithPolicy(ev *Event, policy PanicPolicy) {
 	ev.chainid = self.id
 
-	for _, h := range self.list {
+	if chainPolicy := PanicPolicy(atomic.LoadInt32(&self.panicPolicy)); chainPolicy != Panic_Crash {
+		policy = chainPolicy
+	}
+
+	callHandlerList(self.handlers(), ev, policy)
+}
+
+// 依次调用处理器, 遇到中间件时, 之后的处理器由中间件通过next调用
+func callHandlerList(list []EventHandler, ev *Event, policy PanicPolicy) {
+	for index, h := range list {
 
 		HandlerLog(h, ev)
 
-		h.Call(ev)
+		mw, isMiddleware := h.(*middlewareHandler)
+
+		perr := callProtected(policy, h, ev, func() {
+			if isMiddleware {
+				mw.fn(ev, func() {
+					callHandlerList(list[index+1:], ev, policy)
+				})
+			} else {
+				h.Call(ev)
+			}
+		})
+
+		if perr != nil {
+
+			ev.SetError(perr)
+
+			// 跳过事件时, 结束本条链, 不影响其他链, 读链和写链中丢弃事件
+			if policy == Panic_SkipEvent {
+				ev.SetResult(Result_SkipEvent)
+			} else {
+				ev.SetResult(Result_HandlerPanic)
+			}
+
+			break
+		}
+
+		// 中间件之后的处理器已由next处理, 结果由中间件决定
+		if isMiddleware {
+			break
+		}
 
 		if ev.Result() == Result_NextChain {
 			ev.SetResult(Result_OK)
@@ -90,14 +236,30 @@ func NewHandlerChain(objlist ...interface{}) *HandlerChain {
 	return self
 }
 
+// 已编码的事件使用空的发送处理链, 不再经过Peer的发送处理链, 如转发和重发的封包
+var encodedChainSend = NewHandlerChain()
+
 type HandlerChainList []*HandlerChain
 
 func (self HandlerChainList) Call(ev *Event) {
+	self.callWithPolicy(ev, Panic_Crash)
+}
+
+func (self HandlerChainList) callWithPolicy(ev *Event, policy PanicPolicy) {
 	for _, chain := range self {
 
+		// 每条链使用独立的事件, 共享只读的Data
 		cloned := ev.Clone()
 
-		chain.Call(cloned)
+		chain.callWithPolicy(cloned, policy)
+
+		stop := cloned.Result() == Result_StopPropagation
+
+		cloned.Release()
+
+		if stop {
+			break
+		}
 	}
 }
 
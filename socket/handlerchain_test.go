@@ -0,0 +1,132 @@
+package socket
+
+import (
+	"strings"
+	"testing"
+)
+
+// 记录调用顺序的处理器, fn不为nil时在记录后调用
+type traceHandler struct {
+	name  string
+	trace *[]string
+	fn    func(ev *Event)
+}
+
+func (self *traceHandler) Call(ev *Event) {
+	*self.trace = append(*self.trace, self.name)
+
+	if self.fn != nil {
+		self.fn(ev)
+	}
+}
+
+func (self *traceHandler) HandlerName() string {
+	return self.name
+}
+
+func newTraceHandler(name string, trace *[]string) EventHandler {
+	return &traceHandler{name: name, trace: trace}
+}
+
+func chainNames(chain *HandlerChain) string {
+	var names []string
+	for _, h := range chain.handlers() {
+		names = append(names, HandlerName(h))
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestHandlerChainInsertRemove(t *testing.T) {
+	var trace []string
+
+	chain := NewHandlerChain(newTraceHandler("a", &trace), newTraceHandler("c", &trace))
+
+	if !chain.InsertBefore("c", newTraceHandler("b", &trace)) {
+		t.Fatal("insert before existing handler failed")
+	}
+
+	if !chain.InsertAfter("c", newTraceHandler("d", &trace), newTraceHandler("e", &trace)) {
+		t.Fatal("insert after existing handler failed")
+	}
+
+	if !chain.InsertBefore("a", newTraceHandler("start", &trace)) {
+		t.Fatal("insert before first handler failed")
+	}
+
+	if names := chainNames(chain); names != "start,a,b,c,d,e" {
+		t.Fatalf("got %s, want start,a,b,c,d,e", names)
+	}
+
+	if !chain.Remove("start") || !chain.Remove("e") || !chain.Remove("c") {
+		t.Fatal("remove existing handler failed")
+	}
+
+	// 找不到时不修改
+	if chain.InsertBefore("x", newTraceHandler("y", &trace)) || chain.InsertAfter("x", newTraceHandler("y", &trace)) || chain.Remove("x") {
+		t.Fatal("missing handler reported found")
+	}
+
+	if names := chainNames(chain); names != "a,b,d" {
+		t.Fatalf("got %s, want a,b,d", names)
+	}
+
+	chain.Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "a,b,d" {
+		t.Fatalf("called %s, want a,b,d", called)
+	}
+}
+
+func TestHandlerChainCopyOnWrite(t *testing.T) {
+	var trace []string
+
+	chain := NewHandlerChain(newTraceHandler("a", &trace), newTraceHandler("b", &trace))
+
+	snapshot := chain.handlers()
+
+	chain.Add(newTraceHandler("c", &trace))
+	chain.InsertBefore("a", newTraceHandler("start", &trace))
+	chain.Remove("b")
+
+	// 修改前取得的列表不受影响
+	var names []string
+	for _, h := range snapshot {
+		names = append(names, HandlerName(h))
+	}
+
+	if strings.Join(names, ",") != "a,b" {
+		t.Fatalf("snapshot changed to %v", names)
+	}
+
+	if names := chainNames(chain); names != "start,a,c" {
+		t.Fatalf("got %s, want start,a,c", names)
+	}
+}
+
+func TestHandlerChainModifyDuringCall(t *testing.T) {
+	var trace []string
+
+	chain := NewHandlerChain()
+	chain.AddBatch(
+		&traceHandler{name: "remover", trace: &trace, fn: func(ev *Event) {
+			// 执行中的Call使用调用开始时的列表
+			chain.Remove("b")
+			chain.Add(newTraceHandler("c", &trace))
+		}},
+		newTraceHandler("b", &trace),
+	)
+
+	chain.Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "remover,b" {
+		t.Fatalf("called %s, want remover,b", called)
+	}
+
+	trace = nil
+	chain.Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "remover,c" {
+		t.Fatalf("called %s, want remover,c", called)
+	}
+}
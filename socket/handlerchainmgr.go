@@ -2,21 +2,26 @@ package socket
 
 import (
 	"bytes"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 type HandlerChainManager interface {
 
-	// 添加一条接收处理链
+	// 添加一条接收处理链, 优先级为0
 	AddChainRecv(recv *HandlerChain) int64
 
+	// 按优先级添加接收处理链, 数值小的先执行, 相同优先级按添加顺序执行
+	AddChainRecvWithPriority(recv *HandlerChain, priority int) int64
+
 	// 移除接收处理链, 根据添加时的id
 	RemoveChainRecv(id int64)
 
 	// 接收处理链是否存在
 	ChainRecvExists(id int64) bool
 
-	// 获取当前的处理链(乱序)
+	// 获取当前的处理链, 按优先级排序
 	ChainListRecv() HandlerChainList
 
 	// 设置发送处理链
@@ -33,12 +38,19 @@ type HandlerChainManager interface {
 	SetReadWriteChain(read, write func() *HandlerChain)
 }
 
+// 接收处理链及其优先级
+type recvChainEntry struct {
+	chain    *HandlerChain
+	priority int
+}
+
 type HandlerChainManagerImplement struct {
-	recvChainByID      map[int64]*HandlerChain
-	recvChainGuard     sync.Mutex
-	chainIDAcc         int64
-	recvChainListDirty bool
-	recvChainList      HandlerChainList
+	recvChainByID  map[int64]recvChainEntry
+	recvChainGuard sync.Mutex
+	chainIDAcc     int64
+
+	// 接收处理链列表的快照, 修改时整体替换, 会话遍历时不需要加锁
+	recvChainList atomic.Value // HandlerChainList
 
 	sendChain      *HandlerChain
 	sendChainGuard sync.RWMutex
@@ -58,15 +70,19 @@ func (self *HandlerChainManagerImplement) ChainRecvExists(id int64) bool {
 	return ok
 }
 
-func (self *HandlerChainManagerImplement) AddChainRecv(recv *HandlerChain) (autoID int64) {
+func (self *HandlerChainManagerImplement) AddChainRecv(recv *HandlerChain) int64 {
+	return self.AddChainRecvWithPriority(recv, 0)
+}
+
+func (self *HandlerChainManagerImplement) AddChainRecvWithPriority(recv *HandlerChain, priority int) (autoID int64) {
 	self.recvChainGuard.Lock()
 
 	self.chainIDAcc++
 	// autoID这里是流水生成，每次添加要变化
 	// HandlerChain.id是固定id，用于调试用
 	autoID = self.chainIDAcc
-	self.recvChainByID[autoID] = recv
-	self.recvChainListDirty = true
+	self.recvChainByID[autoID] = recvChainEntry{chain: recv, priority: priority}
+	self.rebuildRecvChainList()
 
 	self.recvChainGuard.Unlock()
 
@@ -77,11 +93,32 @@ func (self *HandlerChainManagerImplement) RemoveChainRecv(id int64) {
 	self.recvChainGuard.Lock()
 
 	delete(self.recvChainByID, id)
-	self.recvChainListDirty = true
+	self.rebuildRecvChainList()
 
 	self.recvChainGuard.Unlock()
 }
 
+// 移除和添加接收处理链后只替换一次快照, 会话不会看到只完成一部分的列表, 返回添加的处理链id
+func (self *HandlerChainManagerImplement) replaceChainRecv(removeIDs []int64, add []recvChainEntry) (idList []int64) {
+	self.recvChainGuard.Lock()
+
+	for _, id := range removeIDs {
+		delete(self.recvChainByID, id)
+	}
+
+	for _, entry := range add {
+		self.chainIDAcc++
+		self.recvChainByID[self.chainIDAcc] = entry
+		idList = append(idList, self.chainIDAcc)
+	}
+
+	self.rebuildRecvChainList()
+
+	self.recvChainGuard.Unlock()
+
+	return
+}
+
 func (self *HandlerChainManagerImplement) SetChainSend(chain *HandlerChain) {
 	self.sendChainGuard.Lock()
 	self.sendChain = chain
@@ -120,23 +157,38 @@ func (self *HandlerChainManagerImplement) ChainSend() *HandlerChain {
 	return self.sendChain
 }
 
-func (self *HandlerChainManagerImplement) ChainListRecv() HandlerChainList {
-	self.recvChainGuard.Lock()
-	defer self.recvChainGuard.Unlock()
+// 重建接收处理链快照, 调用时需要持有recvChainGuard
+func (self *HandlerChainManagerImplement) rebuildRecvChainList() {
+	idList := make([]int64, 0, len(self.recvChainByID))
 
-	if self.recvChainListDirty {
-		self.recvChainList = make(HandlerChainList, len(self.recvChainByID))
-		index := 0
-		for _, chain := range self.recvChainByID {
+	for id := range self.recvChainByID {
+		idList = append(idList, id)
+	}
 
-			self.recvChainList[index] = chain
-			index++
+	// 按优先级排序, 相同优先级按添加顺序
+	sort.Slice(idList, func(i, j int) bool {
+		a, b := self.recvChainByID[idList[i]], self.recvChainByID[idList[j]]
+
+		if a.priority != b.priority {
+			return a.priority < b.priority
 		}
 
-		self.recvChainListDirty = false
+		return idList[i] < idList[j]
+	})
+
+	list := make(HandlerChainList, len(idList))
+
+	for index, id := range idList {
+		list[index] = self.recvChainByID[id].chain
 	}
 
-	return self.recvChainList
+	self.recvChainList.Store(list)
+}
+
+// ChainListRecv 返回的列表不会被修改, 可以在遍历时增删处理链
+func (self *HandlerChainManagerImplement) ChainListRecv() HandlerChainList {
+	list, _ := self.recvChainList.Load().(HandlerChainList)
+	return list
 }
 
 func (self *HandlerChainManagerImplement) ChainString() string {
@@ -153,6 +205,6 @@ func (self *HandlerChainManagerImplement) ChainString() string {
 
 func NewHandlerChainManager() *HandlerChainManagerImplement {
 	return &HandlerChainManagerImplement{
-		recvChainByID: make(map[int64]*HandlerChain),
+		recvChainByID: make(map[int64]recvChainEntry),
 	}
 }
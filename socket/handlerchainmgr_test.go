@@ -0,0 +1,90 @@
+package socket
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecvChainPriority(t *testing.T) {
+	var trace []string
+
+	mgr := NewHandlerChainManager()
+
+	mgr.AddChainRecvWithPriority(NewHandlerChain(newTraceHandler("late", &trace)), 10)
+	mgr.AddChainRecv(NewHandlerChain(newTraceHandler("normal1", &trace)))
+	mgr.AddChainRecvWithPriority(NewHandlerChain(newTraceHandler("early", &trace)), -10)
+	id := mgr.AddChainRecv(NewHandlerChain(newTraceHandler("normal2", &trace)))
+	mgr.AddChainRecv(NewHandlerChain(newTraceHandler("normal3", &trace)))
+
+	// 修改前取得的快照不受影响
+	snapshot := mgr.ChainListRecv()
+	mgr.RemoveChainRecv(id)
+
+	snapshot.Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "early,normal1,normal2,normal3,late" {
+		t.Fatalf("called %s, want early,normal1,normal2,normal3,late", called)
+	}
+
+	trace = nil
+	mgr.ChainListRecv().Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "early,normal1,normal3,late" {
+		t.Fatalf("called %s, want early,normal1,normal3,late", called)
+	}
+}
+
+func TestRecvChainStopPropagation(t *testing.T) {
+	var trace []string
+
+	mgr := NewHandlerChainManager()
+
+	mgr.AddChainRecvWithPriority(NewHandlerChain(&traceHandler{name: "filter", trace: &trace, fn: func(ev *Event) {
+		if ev.MsgID == 1 {
+			ev.SetResult(Result_StopPropagation)
+		}
+	}}, newTraceHandler("after filter", &trace)), -1)
+
+	mgr.AddChainRecv(NewHandlerChain(newTraceHandler("logic", &trace)))
+
+	ev := NewEvent(Event_Recv, nil)
+	ev.MsgID = 1
+	mgr.ChainListRecv().Call(ev)
+
+	if called := strings.Join(trace, ","); called != "filter" {
+		t.Fatalf("called %s, want filter", called)
+	}
+
+	// 结果只影响本次投递, 不写回原事件
+	if ev.Result() != Result_OK {
+		t.Fatalf("original event result %s", ev.Result())
+	}
+
+	trace = nil
+	ev = NewEvent(Event_Recv, nil)
+	ev.MsgID = 2
+	mgr.ChainListRecv().Call(ev)
+
+	if called := strings.Join(trace, ","); called != "filter,after filter,logic" {
+		t.Fatalf("called %s, want filter,after filter,logic", called)
+	}
+}
+
+func TestRecvChainErrorDoesNotStop(t *testing.T) {
+	var trace []string
+
+	mgr := NewHandlerChainManager()
+
+	// 其他结果只结束本条链
+	mgr.AddChainRecv(NewHandlerChain(&traceHandler{name: "failed", trace: &trace, fn: func(ev *Event) {
+		ev.SetResult(Result_CodecError)
+	}}, newTraceHandler("skipped", &trace)))
+
+	mgr.AddChainRecv(NewHandlerChain(newTraceHandler("next chain", &trace)))
+
+	mgr.ChainListRecv().Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "failed,next chain" {
+		t.Fatalf("called %s, want failed,next chain", called)
+	}
+}
@@ -0,0 +1,194 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// HandlerFactory 根据配置参数创建处理器, params为配置中的params字段, 可能为空
+type HandlerFactory func(params json.RawMessage) (EventHandler, error)
+
+var (
+	handlerFactoryByName = map[string]HandlerFactory{}
+	handlerFactoryGuard  sync.RWMutex
+
+	// 保存会话状态的处理器, 只能用于每个会话独立创建的读写链
+	sessionHandlerByName = map[string]bool{}
+)
+
+// RegisterHandlerFactory 按名字注册处理器工厂, 配置中通过名字引用, 重名时panic
+func RegisterHandlerFactory(name string, factory HandlerFactory) {
+	handlerFactoryGuard.Lock()
+	defer handlerFactoryGuard.Unlock()
+
+	if _, ok := handlerFactoryByName[name]; ok {
+		panic("duplicate handler factory: " + name)
+	}
+
+	handlerFactoryByName[name] = factory
+}
+
+// RegisterSessionHandlerFactory 注册保存会话状态的处理器工厂, 如加密, 压缩和序号
+// 这类处理器只能配置在每个会话独立创建的读链和写链中, 不能用于所有会话共享的发送和接收处理链
+func RegisterSessionHandlerFactory(name string, factory HandlerFactory) {
+	RegisterHandlerFactory(name, factory)
+
+	handlerFactoryGuard.Lock()
+	sessionHandlerByName[name] = true
+	handlerFactoryGuard.Unlock()
+}
+
+// 是否为保存会话状态的处理器
+func isSessionHandler(name string) bool {
+	handlerFactoryGuard.RLock()
+	defer handlerFactoryGuard.RUnlock()
+
+	return sessionHandlerByName[name]
+}
+
+// HandlerFactoryNames 已注册的处理器工厂名字
+func HandlerFactoryNames() []string {
+	handlerFactoryGuard.RLock()
+	defer handlerFactoryGuard.RUnlock()
+
+	var list []string
+	for name := range handlerFactoryByName {
+		list = append(list, name)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+// CreateHandler 使用注册的工厂创建处理器
+func CreateHandler(name string, params json.RawMessage) (EventHandler, error) {
+	handlerFactoryGuard.RLock()
+	factory, ok := handlerFactoryByName[name]
+	handlerFactoryGuard.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("handler factory not found: %s", name)
+	}
+
+	h, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("create handler %s: %s", name, err.Error())
+	}
+
+	return h, nil
+}
+
+// 解析参数到v, 没有参数时保持v的默认值
+func parseHandlerParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(params, v)
+}
+
+// 内置处理器, 读写流数据的处理器保存会话状态
+func init() {
+	RegisterSessionHandlerFactory("compress", func(params json.RawMessage) (EventHandler, error) {
+		p := struct {
+			Threshold int `json:"threshold"`
+			Level     int `json:"level"`
+		}{Threshold: 256, Level: -1}
+
+		if err := parseHandlerParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return NewCompressWriter(p.Threshold, p.Level), nil
+	})
+
+	RegisterSessionHandlerFactory("decompress", func(params json.RawMessage) (EventHandler, error) {
+		var p struct {
+			MaxSize int `json:"max_size"`
+		}
+
+		if err := parseHandlerParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return NewDecompressReader(p.MaxSize), nil
+	})
+
+	RegisterSessionHandlerFactory("crypto_reader", func(params json.RawMessage) (EventHandler, error) {
+		return NewCryptoReader(), nil
+	})
+
+	RegisterSessionHandlerFactory("crypto_writer", func(params json.RawMessage) (EventHandler, error) {
+		return NewCryptoWriter(), nil
+	})
+
+	RegisterSessionHandlerFactory("checksum_reader", func(params json.RawMessage) (EventHandler, error) {
+		return NewChecksumReader(), nil
+	})
+
+	RegisterSessionHandlerFactory("checksum_writer", func(params json.RawMessage) (EventHandler, error) {
+		return NewChecksumWriter(), nil
+	})
+
+	RegisterHandlerFactory("relay_reader", func(params json.RawMessage) (EventHandler, error) {
+		return NewRelayReader(), nil
+	})
+
+	RegisterHandlerFactory("relay_writer", func(params json.RawMessage) (EventHandler, error) {
+		return NewRelayWriter(), nil
+	})
+
+	RegisterHandlerFactory("ratelimit", func(params json.RawMessage) (EventHandler, error) {
+		var p struct {
+			MsgRate   float64 `json:"msg_rate"`
+			MsgBurst  int     `json:"msg_burst"`
+			ByteRate  float64 `json:"byte_rate"`
+			ByteBurst int     `json:"byte_burst"`
+			Action    string  `json:"action"`
+		}
+
+		if err := parseHandlerParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		action, err := parseRateLimitAction(p.Action)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRateLimiter(p.MsgRate, p.MsgBurst, p.ByteRate, p.ByteBurst, action), nil
+	})
+
+	RegisterHandlerFactory("message_encoder", func(params json.RawMessage) (EventHandler, error) {
+		p := struct {
+			Codec string `json:"codec"`
+		}{Codec: JSONCodec.Name()}
+
+		if err := parseHandlerParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		codec := FetchCodec(p.Codec)
+		if codec == nil {
+			return nil, fmt.Errorf("codec not found: %s", p.Codec)
+		}
+
+		return NewMessageEncoder(codec), nil
+	})
+}
+
+func parseRateLimitAction(s string) (RateLimitAction, error) {
+	switch s {
+	case "", "drop":
+		return RateLimit_Drop, nil
+	case "delay":
+		return RateLimit_Delay, nil
+	case "close":
+		return RateLimit_Close, nil
+	}
+
+	return RateLimit_Drop, fmt.Errorf("unknown rate limit action: %s", s)
+}
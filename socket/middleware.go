@@ -0,0 +1,32 @@
+package socket
+
+// MiddlewareFunc 中间件, 调用next执行处理链中之后的处理器, 不调用时之后的处理器不执行
+// next返回后可以检查和修改ev.Result(), 用于计时, 重试和清理等
+type MiddlewareFunc func(ev *Event, next func())
+
+type middlewareHandler struct {
+	name string
+	fn   MiddlewareFunc
+}
+
+// Call 不在处理链中使用时, next为空操作
+func (self *middlewareHandler) Call(ev *Event) {
+	self.fn(ev, func() {})
+}
+
+func (self *middlewareHandler) HandlerName() string {
+	return self.name
+}
+
+// NewMiddleware 创建中间件处理器, name用于在处理链中查找, 为空时为"Middleware"
+// 也可以直接将func(ev *Event, next func())传给NewHandlerChain或AddAny
+func NewMiddleware(name string, fn MiddlewareFunc) EventHandler {
+	if name == "" {
+		name = "Middleware"
+	}
+
+	return &middlewareHandler{
+		name: name,
+		fn:   fn,
+	}
+}
@@ -0,0 +1,129 @@
+package socket
+
+import (
+	"strings"
+	"testing"
+)
+
+// 在next前后记录的中间件
+func traceMiddleware(name string, trace *[]string) EventHandler {
+	return NewMiddleware(name, func(ev *Event, next func()) {
+		*trace = append(*trace, name+" before")
+		next()
+		*trace = append(*trace, name+" after")
+	})
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var trace []string
+
+	chain := NewHandlerChain(
+		newTraceHandler("a", &trace),
+		traceMiddleware("outer", &trace),
+		newTraceHandler("b", &trace),
+		traceMiddleware("inner", &trace),
+		newTraceHandler("c", &trace),
+	)
+
+	chain.Call(NewEvent(Event_Recv, nil))
+
+	want := "a,outer before,b,inner before,c,inner after,outer after"
+	if called := strings.Join(trace, ","); called != want {
+		t.Fatalf("called %s, want %s", called, want)
+	}
+}
+
+func TestMiddlewareWithoutNext(t *testing.T) {
+	var trace []string
+
+	chain := NewHandlerChain(
+		NewMiddleware("filter", func(ev *Event, next func()) {
+			trace = append(trace, "filter")
+
+			if ev.MsgID != 1 {
+				next()
+			}
+		}),
+		newTraceHandler("a", &trace),
+	)
+
+	ev := NewEvent(Event_Recv, nil)
+	ev.MsgID = 1
+	chain.Call(ev)
+
+	ev = NewEvent(Event_Recv, nil)
+	ev.MsgID = 2
+	chain.Call(ev)
+
+	if called := strings.Join(trace, ","); called != "filter,filter,a" {
+		t.Fatalf("called %s, want filter,filter,a", called)
+	}
+}
+
+func TestMiddlewareResult(t *testing.T) {
+	var trace []string
+	var seen Result
+
+	chain := NewHandlerChain(
+		// 之后的处理器失败时重试一次并清除错误
+		func(ev *Event, next func()) {
+			next()
+
+			seen = ev.Result()
+
+			if ev.Result() != Result_OK {
+				ev.SetResult(Result_OK)
+				next()
+			}
+		},
+		&traceHandler{name: "flaky", trace: &trace, fn: func(ev *Event) {
+			if len(trace) == 1 {
+				ev.SetResult(Result_CodecError)
+			}
+		}},
+		newTraceHandler("after", &trace),
+	)
+
+	ev := NewEvent(Event_Recv, nil)
+	chain.Call(ev)
+
+	if seen != Result_CodecError {
+		t.Fatalf("middleware saw %s, want %s", seen, Result_CodecError)
+	}
+
+	if ev.Result() != Result_OK {
+		t.Fatalf("chain result %s, want %s", ev.Result(), Result_OK)
+	}
+
+	if called := strings.Join(trace, ","); called != "flaky,flaky,after" {
+		t.Fatalf("called %s, want flaky,flaky,after", called)
+	}
+}
+
+func TestMiddlewareName(t *testing.T) {
+	var trace []string
+
+	chain := NewHandlerChain()
+	chain.AddAny(MiddlewareFunc(func(ev *Event, next func()) {
+		trace = append(trace, "unnamed")
+		next()
+	}), newTraceHandler("a", &trace))
+
+	if !chain.InsertBefore("Middleware", traceMiddleware("first", &trace)) {
+		t.Fatal("unnamed middleware not found by default name")
+	}
+
+	chain.Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "first before,unnamed,a,first after" {
+		t.Fatalf("called %s", called)
+	}
+
+	// 不在处理链中时next为空操作
+	trace = nil
+	traceMiddleware("alone", &trace).Call(NewEvent(Event_Recv, nil))
+
+	if called := strings.Join(trace, ","); called != "alone before,alone after" {
+		t.Fatalf("called %s", called)
+	}
+}
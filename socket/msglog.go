@@ -0,0 +1,103 @@
+package socket
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// MsgLogMode 消息日志的输出方式
+type MsgLogMode int32
+
+const (
+	MsgLog_Off   MsgLogMode = iota // 不输出
+	MsgLog_All                     // 输出所有消息
+	MsgLog_Allow                   // 只输出列出的MsgID
+	MsgLog_Deny                    // 输出列出的MsgID以外的消息
+)
+
+func (self MsgLogMode) String() string {
+	switch self {
+	case MsgLog_Off:
+		return "off"
+	case MsgLog_All:
+		return "all"
+	case MsgLog_Allow:
+		return "allow"
+	case MsgLog_Deny:
+		return "deny"
+	}
+
+	return fmt.Sprintf("unknown(%d)", self)
+}
+
+// 消息日志设置, 修改时整体替换, 每条消息检查时不需要加锁
+type msgLogConfig struct {
+	mode MsgLogMode
+	ids  map[uint32]bool
+}
+
+var msgLogSnapshot atomic.Value // *msgLogConfig
+
+// SetMsgLog 设置消息日志, 可以在运行时修改, ids在MsgLog_Allow和MsgLog_Deny时使用
+func SetMsgLog(mode MsgLogMode, ids ...uint32) {
+	idSet := make(map[uint32]bool)
+	for _, id := range ids {
+		idSet[id] = true
+	}
+
+	msgLogSnapshot.Store(&msgLogConfig{mode: mode, ids: idSet})
+}
+
+func loadMsgLog() *msgLogConfig {
+	cfg, _ := msgLogSnapshot.Load().(*msgLogConfig)
+	if cfg == nil {
+		return &msgLogConfig{}
+	}
+
+	return cfg
+}
+
+// MsgLogSetting 当前的消息日志设置
+func MsgLogSetting() (mode MsgLogMode, ids []uint32) {
+	cfg := loadMsgLog()
+
+	for id := range cfg.ids {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return cfg.mode, ids
+}
+
+func msgLogEnabled(msgID uint32) bool {
+	cfg, _ := msgLogSnapshot.Load().(*msgLogConfig)
+
+	// 未设置或关闭
+	if cfg == nil {
+		return false
+	}
+
+	switch cfg.mode {
+	case MsgLog_All:
+		return true
+	case MsgLog_Allow:
+		return cfg.ids[msgID]
+	case MsgLog_Deny:
+		return !cfg.ids[msgID]
+	}
+
+	return false
+}
+
+// MsgLog 按消息日志设置输出收发的消息
+func MsgLog(ev *Event) {
+	if !msgLogEnabled(ev.MsgID) {
+		return
+	}
+
+	fmt.Printf("#%s(%s) sid: %d msgid: %d size: %d | %s\n", ev.Type, ev.PeerName(), ev.SessionID(), ev.MsgID, ev.MsgSize(), ev.MsgString())
+}
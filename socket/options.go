@@ -2,11 +2,13 @@ package socket
 
 import (
 	"net"
+	"sync"
 	"time"
 )
 
 type SocketOptions interface {
 	// Session最大包大小, 超过这个数字, 接收视为错误, 断开连接
+	// 为0时LengthFrameReader和DecompressReader使用默认上限16M
 	SetMaxPacketSize(size int)
 
 	MaxPacketSize() int
@@ -17,6 +19,23 @@ type SocketOptions interface {
 	// 设置socket超时间隔, 0表示不作用
 	SetSocketDeadline(read, write time.Duration)
 	SocketDeadline() (read, write time.Duration)
+
+	// 设置每个Session的发送队列上限, 分别为事件数量和字节数, 0表示不限制
+	SetSendQueueLimit(maxLen, maxSize int)
+	SendQueueLimit() (maxLen, maxSize int)
+
+	// 设置发送队列超限时的处理策略, blockTimeout只用于Overflow_Block, 0表示一直等待
+	SetSendQueueOverflow(policy OverflowPolicy, blockTimeout time.Duration)
+	SendQueueOverflow() (policy OverflowPolicy, blockTimeout time.Duration)
+
+	// 设置合并写, threshold为写缓冲大小, 缓冲满时立即写出, 0表示不合并
+	// maxDelay为数据在缓冲中的最长停留时间, 0表示每批事件处理完立即写出
+	SetWriteCoalesce(threshold int, maxDelay time.Duration)
+	WriteCoalesce() (threshold int, maxDelay time.Duration)
+
+	// 设置会话收发线程中处理器panic时的处理, 默认不恢复
+	SetPanicPolicy(policy PanicPolicy)
+	PanicPolicy() PanicPolicy
 }
 
 type socketOptions struct {
@@ -27,34 +46,125 @@ type socketOptions struct {
 	connNoDelay      bool
 	connReadTimeout  time.Duration
 	connWriteTimeout time.Duration
+
+	// 发送队列
+	sendQueueMaxLen       int
+	sendQueueMaxSize      int
+	sendQueuePolicy       OverflowPolicy
+	sendQueueBlockTimeout time.Duration
+
+	// 合并写
+	writeCoalesceThreshold int
+	writeCoalesceMaxDelay  time.Duration
+
+	panicPolicy PanicPolicy
+
+	// 选项可以在运行时修改, 会话读取时加读锁
+	guard sync.RWMutex
 }
 
 // socket配置
 func (self *socketOptions) SetMaxPacketSize(size int) {
+	self.guard.Lock()
 	self.maxPacketSize = size
+	self.guard.Unlock()
 }
 
 func (self *socketOptions) MaxPacketSize() int {
+	self.guard.RLock()
+	defer self.guard.RUnlock()
+
 	return self.maxPacketSize
 }
 
 func (self *socketOptions) SetSocketDeadline(read, write time.Duration) {
+	self.guard.Lock()
 	self.connReadTimeout = read
 	self.connWriteTimeout = write
+	self.guard.Unlock()
 }
 
 func (self *socketOptions) SocketDeadline() (read, write time.Duration) {
+	self.guard.RLock()
+	defer self.guard.RUnlock()
+
 	return self.connReadTimeout, self.connWriteTimeout
 }
 
+func (self *socketOptions) SetSendQueueLimit(maxLen, maxSize int) {
+	self.guard.Lock()
+	self.sendQueueMaxLen = maxLen
+	self.sendQueueMaxSize = maxSize
+	self.guard.Unlock()
+}
+
+func (self *socketOptions) SendQueueLimit() (maxLen, maxSize int) {
+	self.guard.RLock()
+	defer self.guard.RUnlock()
+
+	return self.sendQueueMaxLen, self.sendQueueMaxSize
+}
+
+func (self *socketOptions) SetSendQueueOverflow(policy OverflowPolicy, blockTimeout time.Duration) {
+	self.guard.Lock()
+	self.sendQueuePolicy = policy
+	self.sendQueueBlockTimeout = blockTimeout
+	self.guard.Unlock()
+}
+
+func (self *socketOptions) SendQueueOverflow() (policy OverflowPolicy, blockTimeout time.Duration) {
+	self.guard.RLock()
+	defer self.guard.RUnlock()
+
+	return self.sendQueuePolicy, self.sendQueueBlockTimeout
+}
+
+func (self *socketOptions) SetWriteCoalesce(threshold int, maxDelay time.Duration) {
+	self.guard.Lock()
+	self.writeCoalesceThreshold = threshold
+	self.writeCoalesceMaxDelay = maxDelay
+	self.guard.Unlock()
+}
+
+func (self *socketOptions) WriteCoalesce() (threshold int, maxDelay time.Duration) {
+	self.guard.RLock()
+	defer self.guard.RUnlock()
+
+	return self.writeCoalesceThreshold, self.writeCoalesceMaxDelay
+}
+
+func (self *socketOptions) SetPanicPolicy(policy PanicPolicy) {
+	self.guard.Lock()
+	self.panicPolicy = policy
+	self.guard.Unlock()
+}
+
+func (self *socketOptions) PanicPolicy() PanicPolicy {
+	self.guard.RLock()
+	defer self.guard.RUnlock()
+
+	return self.panicPolicy
+}
+
 func (self *socketOptions) SetSocketOption(readBufferSize, writeBufferSize int, nodelay bool) {
+	self.guard.Lock()
 	self.connReadBuffer = readBufferSize
 	self.connWriteBuffer = writeBufferSize
 	self.connNoDelay = nodelay
+	self.guard.Unlock()
 }
 
 func (self *socketOptions) Apply(conn net.Conn) {
+	// 取被包装的原始连接, 如PROXY协议连接
+	if wrapped, ok := conn.(interface {
+		NetConn() net.Conn
+	}); ok {
+		conn = wrapped.NetConn()
+	}
+
 	if cc, ok := conn.(*net.TCPConn); ok {
+		self.guard.RLock()
+		defer self.guard.RUnlock()
 
 		if self.connReadBuffer >= 0 {
 			cc.SetReadBuffer(self.connReadBuffer)
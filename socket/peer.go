@@ -2,6 +2,7 @@ package socket
 
 import (
 	"net"
+	"sync"
 )
 
 // Peer 端, Connector或Acceptor
@@ -36,33 +37,45 @@ type socketPeer struct {
 	// socket配置
 	*socketOptions
 
-	// 停止过程同步
-	stopping chan bool
+	// 停止过程同步, 停止结束时关闭
+	stopping      chan bool
+	stoppingGuard sync.Mutex
 }
 
 func (self *socketPeer) waitStopFinished() {
+	self.stoppingGuard.Lock()
+	stopping := self.stopping
+	self.stoppingGuard.Unlock()
+
 	// 如果正在停止时, 等待停止完成
-	if self.stopping != nil {
-		<-self.stopping
-		self.stopping = nil
+	if stopping != nil {
+		<-stopping
 	}
 }
 
 func (self *socketPeer) isStopping() bool {
+	self.stoppingGuard.Lock()
+	defer self.stoppingGuard.Unlock()
+
 	return self.stopping != nil
 }
 
 func (self *socketPeer) startStopping() {
+	self.stoppingGuard.Lock()
 	self.stopping = make(chan bool)
+	self.stoppingGuard.Unlock()
 }
 
+// 关闭通道, 在endStopping前后开始等待的都能返回
 func (self *socketPeer) endStopping() {
-	select {
-	case self.stopping <- true:
+	self.stoppingGuard.Lock()
 
-	default:
+	if self.stopping != nil {
+		close(self.stopping)
 		self.stopping = nil
 	}
+
+	self.stoppingGuard.Unlock()
 }
 
 func newSocketPeer(sm SessionManager) *socketPeer {
@@ -85,6 +98,18 @@ func newSocketPeer(sm SessionManager) *socketPeer {
 	return self
 }
 
+// 会话改用指定的ID, 会话管理器不支持时返回false
+func (self *socketPeer) reassignSession(ses Session, id int64) bool {
+	sm, ok := self.SessionManager.(*SessionManagerImplement)
+	if !ok {
+		return false
+	}
+
+	sm.reassign(ses, id)
+
+	return true
+}
+
 func errToResult(err error) Result {
 	if err == nil {
 		return Result_OK
@@ -0,0 +1,444 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Duration 配置中的时间间隔, 格式同time.ParseDuration, 如"5s"
+type Duration time.Duration
+
+func (self *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	if s == "" {
+		*self = 0
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*self = Duration(d)
+
+	return nil
+}
+
+func (self Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(self).String())
+}
+
+// HandlerConfig 处理器配置, Name为RegisterHandlerFactory注册的名字
+type HandlerConfig struct {
+	Name   string          `json:"name"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// ChainConfig 接收处理链配置
+type ChainConfig struct {
+	Priority int             `json:"priority"`
+	Handlers []HandlerConfig `json:"handlers"`
+}
+
+// FramingConfig 封包格式, Type为length(默认)或fixed, fixed时Size为封包长度
+type FramingConfig struct {
+	Type string `json:"type"`
+	Size int    `json:"size"`
+}
+
+// PeerConfig 一个Peer的配置
+type PeerConfig struct {
+	Type    string `json:"type"` // acceptor或connector
+	Name    string `json:"name"`
+	Address string `json:"address"`
+
+	// socket选项, 缓冲大小0表示不修改
+	ReadBufferSize  int  `json:"read_buffer_size"`
+	WriteBufferSize int  `json:"write_buffer_size"`
+	NoDelay         bool `json:"no_delay"`
+	MaxPacketSize   int  `json:"max_packet_size"`
+
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+
+	// 发送队列, 策略为dropnewest(默认), dropoldest, block, close
+	SendQueueMaxLen       int      `json:"send_queue_max_len"`
+	SendQueueMaxSize      int      `json:"send_queue_max_size"`
+	SendQueuePolicy       string   `json:"send_queue_policy"`
+	SendQueueBlockTimeout Duration `json:"send_queue_block_timeout"`
+
+	WriteCoalesceThreshold int      `json:"write_coalesce_threshold"`
+	WriteCoalesceMaxDelay  Duration `json:"write_coalesce_max_delay"`
+
+	// crash(默认), skipevent, closesession
+	PanicPolicy string `json:"panic_policy"`
+
+	// connector: 重连间隔
+	ReconnectSec int `json:"reconnect_sec"`
+
+	// acceptor: 每个IP的新建连接速度限制, PROXY协议
+	ConnectionRate  float64 `json:"connection_rate"`
+	ConnectionBurst int     `json:"connection_burst"`
+	ProxyProtocol   bool    `json:"proxy_protocol"`
+
+	Framing FramingConfig `json:"framing"`
+
+	// 设置时在发送处理链开头加入对应编解码的MessageEncoder
+	Codec string `json:"codec"`
+
+	Read  []HandlerConfig `json:"read"`  // 读链中封包读取之后的处理器, 每个会话独立创建
+	Write []HandlerConfig `json:"write"` // 写链中封包写入之前的处理器, 每个会话独立创建
+	Send  []HandlerConfig `json:"send"`  // 发送处理链, 所有会话共享
+	Recv  []ChainConfig   `json:"recv"`  // 接收处理链, 所有会话共享
+}
+
+// Config 配置文件
+type Config struct {
+	Peers []PeerConfig `json:"peers"`
+}
+
+// LoadConfig 读取JSON配置文件
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseConfig(data)
+}
+
+// ParseConfig 解析JSON配置并检查
+func ParseConfig(data []byte) (*Config, error) {
+	var self Config
+
+	if err := json.Unmarshal(data, &self); err != nil {
+		return nil, err
+	}
+
+	for index := range self.Peers {
+		if err := self.Peers[index].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &self, nil
+}
+
+// NewPeers 按配置创建所有Peer, 不启动
+func (self *Config) NewPeers() ([]Peer, error) {
+	var list []Peer
+
+	for index := range self.Peers {
+		p, err := self.Peers[index].NewPeer()
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, p)
+	}
+
+	return list, nil
+}
+
+func (self *PeerConfig) String() string {
+	if self.Name != "" {
+		return self.Name
+	}
+
+	return self.Address
+}
+
+// Validate 检查配置, 并试创建所有处理器
+func (self *PeerConfig) Validate() error {
+	switch self.Type {
+	case "acceptor", "connector":
+	default:
+		return fmt.Errorf("peer %s: unknown type: %s", self, self.Type)
+	}
+
+	if _, err := self.frameHandlers(); err != nil {
+		return fmt.Errorf("peer %s: %s", self, err.Error())
+	}
+
+	if _, err := parseOverflowPolicy(self.SendQueuePolicy); err != nil {
+		return fmt.Errorf("peer %s: %s", self, err.Error())
+	}
+
+	if _, err := parsePanicPolicy(self.PanicPolicy); err != nil {
+		return fmt.Errorf("peer %s: %s", self, err.Error())
+	}
+
+	if self.Codec != "" && FetchCodec(self.Codec) == nil {
+		return fmt.Errorf("peer %s: codec not found: %s", self, self.Codec)
+	}
+
+	for _, list := range [][]HandlerConfig{self.Read, self.Write, self.Send} {
+		if _, err := createHandlers(list); err != nil {
+			return fmt.Errorf("peer %s: %s", self, err.Error())
+		}
+	}
+
+	// 发送和接收处理链由所有会话共享
+	if err := checkSharedHandlers(self.Send); err != nil {
+		return fmt.Errorf("peer %s: send: %s", self, err.Error())
+	}
+
+	for _, chain := range self.Recv {
+		if _, err := createHandlers(chain.Handlers); err != nil {
+			return fmt.Errorf("peer %s: %s", self, err.Error())
+		}
+
+		if err := checkSharedHandlers(chain.Handlers); err != nil {
+			return fmt.Errorf("peer %s: recv: %s", self, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// NewPeer 按配置创建Peer, 不启动, 启动时使用Start(Address)
+func (self *PeerConfig) NewPeer() (Peer, error) {
+	p, _, err := self.newPeer()
+	return p, err
+}
+
+// 创建Peer, 同时返回添加的接收处理链id
+func (self *PeerConfig) newPeer() (Peer, []int64, error) {
+	if err := self.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var p Peer
+
+	if self.Type == "acceptor" {
+		p = NewAcceptor()
+	} else {
+		p = NewConnector()
+	}
+
+	p.SetName(self.Name)
+	p.SetAddress(self.Address)
+
+	if err := self.ApplyOptions(p); err != nil {
+		return nil, nil, err
+	}
+
+	recvChainIDs, err := self.applyChains(p, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p, recvChainIDs, nil
+}
+
+// ApplyOptions 将配置中的选项设置到Peer, 只影响之后创建的会话
+// 可以在运行时重复调用, 已建立的会话参见ConfigReloader.SetApplyToExisting
+func (self *PeerConfig) ApplyOptions(p Peer) error {
+	opt := p.(SocketOptions)
+
+	readBufferSize, writeBufferSize := self.ReadBufferSize, self.WriteBufferSize
+	if readBufferSize == 0 {
+		readBufferSize = -1
+	}
+
+	if writeBufferSize == 0 {
+		writeBufferSize = -1
+	}
+
+	opt.SetSocketOption(readBufferSize, writeBufferSize, self.NoDelay)
+	opt.SetMaxPacketSize(self.MaxPacketSize)
+	opt.SetSocketDeadline(time.Duration(self.ReadTimeout), time.Duration(self.WriteTimeout))
+
+	policy, err := parseOverflowPolicy(self.SendQueuePolicy)
+	if err != nil {
+		return err
+	}
+
+	opt.SetSendQueueLimit(self.SendQueueMaxLen, self.SendQueueMaxSize)
+	opt.SetSendQueueOverflow(policy, time.Duration(self.SendQueueBlockTimeout))
+	opt.SetWriteCoalesce(self.WriteCoalesceThreshold, time.Duration(self.WriteCoalesceMaxDelay))
+
+	panicPolicy, err := parsePanicPolicy(self.PanicPolicy)
+	if err != nil {
+		return err
+	}
+
+	opt.SetPanicPolicy(panicPolicy)
+
+	if connector, ok := p.(Connector); ok {
+		connector.SetAutoReconnectSec(self.ReconnectSec)
+	}
+
+	if acceptor, ok := p.(Acceptor); ok {
+		acceptor.SetConnectionRateLimit(self.ConnectionRate, self.ConnectionBurst)
+		acceptor.SetProxyProtocol(self.ProxyProtocol)
+	}
+
+	return nil
+}
+
+// ApplyChains 按配置设置读写链, 发送处理链, 并添加接收处理链
+func (self *PeerConfig) ApplyChains(p Peer) error {
+	_, err := self.applyChains(p, nil)
+	return err
+}
+
+// 设置处理链, 同时移除replaceIDs对应的接收处理链, 返回添加的接收处理链id, 重新加载时用于替换
+// 先创建所有处理器, 出错时不修改Peer
+func (self *PeerConfig) applyChains(p Peer, replaceIDs []int64) ([]int64, error) {
+	frame, err := self.frameHandlers()
+	if err != nil {
+		return nil, err
+	}
+
+	sendList, err := createHandlers(self.Send)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Codec != "" {
+		sendList = append([]EventHandler{NewMessageEncoder(FetchCodec(self.Codec))}, sendList...)
+	}
+
+	var recvList []recvChainEntry
+
+	for _, chain := range self.Recv {
+		list, err := createHandlers(chain.Handlers)
+		if err != nil {
+			return nil, err
+		}
+
+		recvList = append(recvList, recvChainEntry{chain: NewHandlerChain(list), priority: chain.Priority})
+	}
+
+	// 读写链每个会话独立创建, 在这里先试创建一次, 工厂出错时返回错误
+	readList, writeList := self.Read, self.Write
+
+	for _, list := range [][]HandlerConfig{readList, writeList} {
+		if _, err := createHandlers(list); err != nil {
+			return nil, err
+		}
+	}
+
+	p.SetReadWriteChain(func() *HandlerChain {
+		reader, _ := frame()
+		return NewHandlerChain(reader, createSessionHandlers(readList))
+	}, func() *HandlerChain {
+		_, writer := frame()
+		return NewHandlerChain(createSessionHandlers(writeList), writer)
+	})
+
+	if len(sendList) > 0 {
+		p.SetChainSend(NewHandlerChain(sendList))
+	} else {
+		p.SetChainSend(nil)
+	}
+
+	// 新旧接收处理链一次替换, 不会出现没有处理链或缺少高优先级处理链的时刻
+	return p.(interface {
+		replaceChainRecv(removeIDs []int64, add []recvChainEntry) []int64
+	}).replaceChainRecv(replaceIDs, recvList), nil
+}
+
+// 返回创建封包读写处理器的函数
+func (self *PeerConfig) frameHandlers() (func() (reader, writer EventHandler), error) {
+	switch self.Framing.Type {
+	case "", "length":
+		return func() (EventHandler, EventHandler) {
+			return NewLengthFrameReader(), NewLengthFrameWriter()
+		}, nil
+	case "fixed":
+		if self.Framing.Size <= 0 {
+			return nil, fmt.Errorf("invalid fixed frame size: %d", self.Framing.Size)
+		}
+
+		size := self.Framing.Size
+
+		return func() (EventHandler, EventHandler) {
+			return NewFixedLengthFrameReader(size), NewFixedLengthFrameWriter()
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown framing: %s", self.Framing.Type)
+}
+
+// 共享的处理链中不能使用保存会话状态的处理器
+func checkSharedHandlers(list []HandlerConfig) error {
+	for _, hc := range list {
+		if isSessionHandler(hc.Name) {
+			return fmt.Errorf("handler %s keeps per-session state, use it in read or write", hc.Name)
+		}
+	}
+
+	return nil
+}
+
+func createHandlers(list []HandlerConfig) ([]EventHandler, error) {
+	var ret []EventHandler
+
+	for _, hc := range list {
+		h, err := CreateHandler(hc.Name, hc.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, h)
+	}
+
+	return ret, nil
+}
+
+// 会话创建读写链时调用, 工厂已检查过, 仍然出错时只断开这个会话
+func createSessionHandlers(list []HandlerConfig) []EventHandler {
+	ret, err := createHandlers(list)
+	if err != nil {
+		fmt.Println(err.Error())
+		return []EventHandler{&handlerErrorHandler{err: err}}
+	}
+
+	return ret
+}
+
+// 代替创建失败的处理器, 连接建立事件以该错误结束, 会话随之断开
+type handlerErrorHandler struct {
+	err error
+}
+
+func (self *handlerErrorHandler) Call(ev *Event) {
+	ev.SetError(self.err)
+}
+
+func parseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, policy := range []OverflowPolicy{Overflow_DropNewest, Overflow_DropOldest, Overflow_Block, Overflow_Close} {
+		if s == policy.String() {
+			return policy, nil
+		}
+	}
+
+	if s == "" {
+		return Overflow_DropNewest, nil
+	}
+
+	return Overflow_DropNewest, fmt.Errorf("unknown send queue policy: %s", s)
+}
+
+func parsePanicPolicy(s string) (PanicPolicy, error) {
+	for _, policy := range []PanicPolicy{Panic_Crash, Panic_SkipEvent, Panic_CloseSession} {
+		if s == policy.String() {
+			return policy, nil
+		}
+	}
+
+	if s == "" {
+		return Panic_Crash, nil
+	}
+
+	return Panic_Crash, fmt.Errorf("unknown panic policy: %s", s)
+}
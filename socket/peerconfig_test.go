@@ -0,0 +1,158 @@
+package socket
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// 剩余可成功创建的次数, 用完后test_flaky工厂返回错误
+var testFlakyLeft int32
+
+func init() {
+	RegisterHandlerFactory("test_fail", func(params json.RawMessage) (EventHandler, error) {
+		return nil, errors.New("always fail")
+	})
+
+	RegisterHandlerFactory("test_flaky", func(params json.RawMessage) (EventHandler, error) {
+		if atomic.AddInt32(&testFlakyLeft, -1) < 0 {
+			return nil, errors.New("no more handlers")
+		}
+
+		return newTraceHandler("flaky", new([]string)), nil
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{"peers": [{
+		"type": "acceptor",
+		"name": "game",
+		"address": "127.0.0.1:0",
+		"max_packet_size": 1024,
+		"read_timeout": "5s",
+		"send_queue_policy": "dropoldest",
+		"panic_policy": "closesession",
+		"framing": {"type": "fixed", "size": 16},
+		"codec": "json",
+		"read": [{"name": "test_trace", "params": {"name": "read"}}],
+		"recv": [{"priority": 1, "handlers": [{"name": "test_trace", "params": {"name": "recv"}}]}]
+	}]}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := cfg.NewPeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("%d peers, want 1", len(list))
+	}
+
+	p := list[0]
+
+	if _, ok := p.(Acceptor); !ok || p.Name() != "game" || p.Address() != "127.0.0.1:0" {
+		t.Fatalf("peer %T %s %s", p, p.Name(), p.Address())
+	}
+
+	opt := p.(SocketOptions)
+
+	if policy, _ := opt.SendQueueOverflow(); policy != Overflow_DropOldest {
+		t.Fatalf("send queue policy %s", policy)
+	}
+
+	if policy := opt.PanicPolicy(); policy != Panic_CloseSession {
+		t.Fatalf("panic policy %s", policy)
+	}
+
+	if got := chainNames(p.CreateChainRead()); !strings.HasSuffix(got, ",read") {
+		t.Fatalf("read chain %s", got)
+	}
+
+	if got := recvChainNames(p); got != "recv" {
+		t.Fatalf("recv chains %s", got)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		peer string
+		err  string
+	}{
+		{`{"type": "server"}`, "unknown type: server"},
+		{`{"type": "acceptor", "framing": {"type": "line"}}`, "unknown framing: line"},
+		{`{"type": "acceptor", "framing": {"type": "fixed"}}`, "invalid fixed frame size: 0"},
+		{`{"type": "acceptor", "send_queue_policy": "drop"}`, "unknown send queue policy: drop"},
+		{`{"type": "acceptor", "panic_policy": "ignore"}`, "unknown panic policy: ignore"},
+		{`{"type": "acceptor", "codec": "xml"}`, "codec not found: xml"},
+		{`{"type": "acceptor", "read_timeout": "5"}`, "missing unit"},
+		{`{"type": "acceptor", "read": [{"name": "none"}]}`, "handler factory not found: none"},
+		{`{"type": "acceptor", "write": [{"name": "test_fail"}]}`, "create handler test_fail: always fail"},
+		{`{"type": "acceptor", "recv": [{"handlers": [{"name": "test_fail"}]}]}`, "create handler test_fail: always fail"},
+		{`{"type": "acceptor", "read": [{"name": "ratelimit", "params": {"msg_rate": "fast"}}]}`, "create handler ratelimit"},
+		{`{"type": "acceptor", "send": [{"name": "compress"}]}`, "handler compress keeps per-session state"},
+		{`{"type": "acceptor", "recv": [{"handlers": [{"name": "crypto_reader"}]}]}`, "handler crypto_reader keeps per-session state"},
+	}
+
+	for _, tc := range tests {
+		_, err := ParseConfig([]byte(`{"peers": [` + tc.peer + `]}`))
+
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: got error %v, want %q", tc.peer, err, tc.err)
+		}
+	}
+}
+
+func TestApplyChainsFactoryError(t *testing.T) {
+	p := NewAcceptor()
+	p.SetChainSend(NewHandlerChain(newTraceHandler("send", new([]string))))
+
+	readBefore := chainNames(p.CreateChainRead())
+
+	for _, cfg := range []PeerConfig{
+		{Read: []HandlerConfig{{Name: "test_fail"}}},
+		{Write: []HandlerConfig{{Name: "test_fail"}}},
+		{Read: []HandlerConfig{{Name: "none"}}},
+	} {
+		// 没有经过Validate的配置, 在应用时检查读写链的工厂
+		if err := cfg.ApplyChains(p); err == nil {
+			t.Fatalf("applied %v", cfg)
+		}
+
+		if got := chainNames(p.CreateChainRead()); got != readBefore {
+			t.Fatalf("read chain changed to %s", got)
+		}
+
+		if got := chainNames(p.ChainSend()); got != "send" {
+			t.Fatalf("send chain changed to %s", got)
+		}
+	}
+}
+
+func TestSessionHandlerFactoryError(t *testing.T) {
+	atomic.StoreInt32(&testFlakyLeft, 2)
+
+	cfg := PeerConfig{Type: "acceptor", Read: []HandlerConfig{{Name: "test_flaky"}}}
+
+	// 检查和应用配置时各创建一次
+	p, err := cfg.NewPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 之后会话创建失败时不panic, 只断开这个会话
+	ses, _ := newPipeSessions(p)
+	defer ses.conn.Close()
+
+	if ses.postSystemEvent(Event_Accepted) {
+		t.Fatal("accepted with failed handler")
+	}
+
+	if reason := ses.CloseReason(); reason.Result != Result_SocketError || reason.Err == nil || !strings.Contains(reason.Err.Error(), "no more handlers") {
+		t.Fatalf("close reason %s", reason)
+	}
+}
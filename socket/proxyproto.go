@@ -0,0 +1,212 @@
+package socket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 读取PROXY协议头的超时
+const proxyHeaderTimeout = 5 * time.Second
+
+// v1头最大长度, 包括结尾的\r\n
+const proxyV1MaxLength = 107
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const proxyV1Prefix = "PROXY "
+
+// 区分v1和v2需要预读的长度
+const proxyPrefixLength = len(proxyV1Prefix)
+
+var errProxyHeader = errors.New("invalid proxy protocol header")
+
+// 解析PROXY协议头后的连接, 地址为负载均衡前的真实地址
+type proxyConn struct {
+	net.Conn
+
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (self *proxyConn) Read(p []byte) (int, error) {
+	return self.reader.Read(p)
+}
+
+func (self *proxyConn) RemoteAddr() net.Addr {
+	return self.remoteAddr
+}
+
+func (self *proxyConn) LocalAddr() net.Addr {
+	return self.localAddr
+}
+
+// NetConn 取负载均衡到本机的原始连接
+func (self *proxyConn) NetConn() net.Conn {
+	return self.Conn
+}
+
+// 读取并解析PROXY协议v1或v2头, 没有协议头时返回错误
+func readProxyHeader(conn net.Conn) (net.Conn, error) {
+	conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	self := &proxyConn{
+		Conn:       conn,
+		reader:     bufio.NewReader(conn),
+		remoteAddr: conn.RemoteAddr(),
+		localAddr:  conn.LocalAddr(),
+	}
+
+	// 只预读两种协议头共同的最小长度, 最短的v1头只有15字节, 预读更多会等到超时
+	prefix, err := self.reader.Peek(proxyPrefixLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(prefix, proxyV2Signature[:proxyPrefixLength]) {
+		err = self.readV2()
+	} else if string(prefix) == proxyV1Prefix {
+		err = self.readV1()
+	} else {
+		err = errProxyHeader
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func (self *proxyConn) readV1() error {
+	var line []byte
+
+	for {
+		b, err := self.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		line = append(line, b)
+
+		if b == '\n' {
+			break
+		}
+
+		if len(line) >= proxyV1MaxLength {
+			return errProxyHeader
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return errProxyHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+
+	if len(fields) < 2 {
+		return errProxyHeader
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		// 保留原始地址
+		return nil
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return errProxyHeader
+		}
+	default:
+		return errProxyHeader
+	}
+
+	src, err := parseProxyV1Addr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+
+	dst, err := parseProxyV1Addr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+
+	self.remoteAddr = src
+	self.localAddr = dst
+
+	return nil
+}
+
+func parseProxyV1Addr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, errProxyHeader
+	}
+
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(portNum)}, nil
+}
+
+// 签名(12) + 版本和命令(1) + 地址族和协议(1) + 地址长度(2, 大端) + 地址
+func (self *proxyConn) readV2() error {
+	var header [16]byte
+
+	if _, err := io.ReadFull(self.reader, header[:]); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(header[:len(proxyV2Signature)], proxyV2Signature) || header[12]>>4 != 2 {
+		return errProxyHeader
+	}
+
+	command := header[12] & 0xF
+	family := header[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+
+	if _, err := io.ReadFull(self.reader, payload); err != nil {
+		return err
+	}
+
+	switch command {
+	case 0:
+		// LOCAL, 负载均衡自身的连接(如健康检查), 保留原始地址
+		return nil
+	case 1:
+	default:
+		return errProxyHeader
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return errProxyHeader
+		}
+
+		self.remoteAddr = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:]))}
+		self.localAddr = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:]))}
+
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return errProxyHeader
+		}
+
+		self.remoteAddr = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:]))}
+		self.localAddr = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:]))}
+	}
+
+	// 其他地址族保留原始地址
+	return nil
+}
@@ -0,0 +1,169 @@
+package socket
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 构造v2头, verCmd为版本和命令, family为地址族和协议
+func proxyV2Header(verCmd, family byte, payload []byte) []byte {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, verCmd, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(payload)))
+
+	return append(header, payload...)
+}
+
+func proxyV2TCP4(src, dst string, srcPort, dstPort uint16) []byte {
+	payload := make([]byte, 12)
+	copy(payload[0:], net.ParseIP(src).To4())
+	copy(payload[4:], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(payload[8:], srcPort)
+	binary.BigEndian.PutUint16(payload[10:], dstPort)
+
+	return payload
+}
+
+func proxyV2TCP6(src, dst string, srcPort, dstPort uint16) []byte {
+	payload := make([]byte, 36)
+	copy(payload[0:], net.ParseIP(src).To16())
+	copy(payload[16:], net.ParseIP(dst).To16())
+	binary.BigEndian.PutUint16(payload[32:], srcPort)
+	binary.BigEndian.PutUint16(payload[34:], dstPort)
+
+	return payload
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		remote string // 为空时表示保留原始地址
+		local  string
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"), "192.168.0.1:56324", "192.168.0.11:443"},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1000 2000\r\n"), "[2001:db8::1]:1000", "[2001:db8::2]:2000"},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", ""},
+		{"v1 unknown with addresses", []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"), "", ""},
+		{"v2 tcp4", proxyV2Header(0x21, 0x11, proxyV2TCP4("10.0.0.1", "10.0.0.2", 1000, 2000)), "10.0.0.1:1000", "10.0.0.2:2000"},
+		{"v2 tcp6", proxyV2Header(0x21, 0x21, proxyV2TCP6("2001:db8::1", "2001:db8::2", 1000, 2000)), "[2001:db8::1]:1000", "[2001:db8::2]:2000"},
+		{"v2 tcp4 with tlv", proxyV2Header(0x21, 0x11, append(proxyV2TCP4("10.0.0.1", "10.0.0.2", 1000, 2000), 1, 0, 1, 'x')), "10.0.0.1:1000", "10.0.0.2:2000"},
+		{"v2 local", proxyV2Header(0x20, 0x00, nil), "", ""},
+		{"v2 unix", proxyV2Header(0x21, 0x31, make([]byte, 216)), "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			// 协议头之后的数据不能丢
+			go client.Write(append(tc.header, "body"...))
+
+			conn, err := readProxyHeader(server)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			remote, local := tc.remote, tc.local
+			if remote == "" {
+				remote, local = server.RemoteAddr().String(), server.LocalAddr().String()
+			}
+
+			if conn.RemoteAddr().String() != remote || conn.LocalAddr().String() != local {
+				t.Fatalf("got %s -> %s, want %s -> %s", conn.RemoteAddr(), conn.LocalAddr(), remote, local)
+			}
+
+			body := make([]byte, 4)
+			if _, err := io.ReadFull(conn, body); err != nil || string(body) != "body" {
+				t.Fatalf("body after header: %q %v", body, err)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		valid  bool
+	}{
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), true},
+		{"v2 local", proxyV2Header(0x20, 0x00, nil), true},
+		{"v1 shorter than v2 signature", []byte("PROXY \r\n"), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			// 只有协议头, 客户端等待服务器先发送数据, 不能等到读取超时
+			go client.Write(tc.header)
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := readProxyHeader(server)
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				if (err == nil) != tc.valid {
+					t.Fatalf("got error %v, want valid %v", err, tc.valid)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("blocked reading header without body")
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"no header", []byte("GET / HTTP/1.1\r\n\r\n")},
+		{"bad v2 signature", append([]byte("\r\n\r\n\x00\r\nQUIX\n"), 0x21, 0x11, 0, 0)},
+		{"v1 line too long", []byte("PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength))},
+		{"v1 missing crlf", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n")},
+		{"v1 missing protocol", []byte("PROXY \r\n           ")},
+		{"v1 bad protocol", []byte("PROXY UDP4 192.168.0.1 192.168.0.11 56324 443\r\n")},
+		{"v1 missing field", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n")},
+		{"v1 extra field", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443 1\r\n")},
+		{"v1 bad source ip", []byte("PROXY TCP4 192.168.0 192.168.0.11 56324 443\r\n")},
+		{"v1 bad dest ip", []byte("PROXY TCP4 192.168.0.1 host 56324 443\r\n")},
+		{"v1 bad port", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 65536 443\r\n")},
+		{"v1 negative port", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 -1\r\n")},
+		{"v2 bad version", proxyV2Header(0x11, 0x11, proxyV2TCP4("10.0.0.1", "10.0.0.2", 1000, 2000))},
+		{"v2 bad command", proxyV2Header(0x22, 0x11, proxyV2TCP4("10.0.0.1", "10.0.0.2", 1000, 2000))},
+		{"v2 short tcp4 address", proxyV2Header(0x21, 0x11, make([]byte, 11))},
+		{"v2 short tcp6 address", proxyV2Header(0x21, 0x21, make([]byte, 35))},
+		{"v2 truncated header", proxyV2Signature},
+		{"v2 truncated payload", proxyV2Header(0x21, 0x11, proxyV2TCP4("10.0.0.1", "10.0.0.2", 1000, 2000))[:20]},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			// 写完后关闭, 头不完整时读取方得到EOF
+			go func() {
+				client.Write(tc.header)
+				client.Close()
+			}()
+
+			if conn, err := readProxyHeader(server); err == nil {
+				t.Fatalf("malformed header accepted: %s -> %s", conn.RemoteAddr(), conn.LocalAddr())
+			}
+		})
+	}
+}
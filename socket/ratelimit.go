@@ -0,0 +1,249 @@
+package socket
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// 令牌桶, rate为每秒补充的令牌数, burst为桶容量
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	tokens float64
+	last   time.Time
+
+	guard sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 调用时需要持有锁
+func (self *tokenBucket) refill(now time.Time) {
+	self.tokens += now.Sub(self.last).Seconds() * self.rate
+	if self.tokens > self.burst {
+		self.tokens = self.burst
+	}
+
+	self.last = now
+}
+
+// 取n个令牌, 不足时不取, 返回还需要等待的时间, 0表示取到
+func (self *tokenBucket) take(n float64) time.Duration {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	self.refill(time.Now())
+
+	// 超过桶容量的请求, 桶满时允许通过, 防止永远无法取到
+	if n > self.burst {
+		n = self.burst
+	}
+
+	if self.tokens >= n {
+		self.tokens -= n
+		return 0
+	}
+
+	return time.Duration((n - self.tokens) / self.rate * float64(time.Second))
+}
+
+// 桶是否已满, 满的桶可以丢弃
+func (self *tokenBucket) idle(now time.Time) bool {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	self.refill(now)
+
+	return self.tokens >= self.burst
+}
+
+// RateLimitAction 超过限速时的处理
+type RateLimitAction int32
+
+const (
+	RateLimit_Drop  RateLimitAction = iota // 丢弃消息, 不再投递到之后的接收处理链
+	RateLimit_Delay                        // 等待令牌补充后继续处理, 会阻塞会话的接收
+	RateLimit_Close                        // 以Result_RateLimited关闭会话
+)
+
+// RateLimiter 按会话限制每秒接收的消息数和字节数, 放在优先级最高的接收处理链的开始
+// 也可以放在读链的封包读取之后, 此时RateLimit_Drop丢弃的消息不会投递到接收处理链
+type RateLimiter struct {
+	msgRate   float64
+	msgBurst  int
+	byteRate  float64
+	byteBurst int
+
+	action RateLimitAction
+}
+
+// 每个会话的令牌桶, 保存在会话上
+type rateLimitState struct {
+	msg  *tokenBucket
+	byte *tokenBucket
+}
+
+func (self *RateLimiter) Call(ev *Event) {
+	if ev.Type != Event_Recv {
+		return
+	}
+
+	state := self.sessionState(ev.Ses)
+
+	var wait time.Duration
+
+	if state.msg != nil {
+		wait = state.msg.take(1)
+	}
+
+	if wait == 0 && state.byte != nil {
+		wait = state.byte.take(float64(ev.MsgSize()))
+	}
+
+	if wait == 0 {
+		return
+	}
+
+	switch self.action {
+	case RateLimit_Delay:
+		time.Sleep(wait)
+
+		// 等待期间补充的令牌由本次消息消耗
+		if state.msg != nil {
+			state.msg.take(1)
+		}
+
+		if state.byte != nil {
+			state.byte.take(float64(ev.MsgSize()))
+		}
+
+	case RateLimit_Close:
+		ev.SetResult(Result_RateLimited)
+		ev.Ses.CloseWithReason(Result_RateLimited, nil)
+	default:
+		ev.SetResult(Result_StopPropagation)
+	}
+}
+
+func (self *RateLimiter) sessionState(ses Session) *rateLimitState {
+	ctx := ses.(interface {
+		Context(key interface{}) interface{}
+		SetContext(key, value interface{})
+	})
+
+	// 同一会话可能挂多个限速器, 以限速器自身为key
+	if state, ok := ctx.Context(self).(*rateLimitState); ok {
+		return state
+	}
+
+	state := &rateLimitState{}
+
+	if self.msgRate > 0 {
+		state.msg = newTokenBucket(self.msgRate, self.msgBurst)
+	}
+
+	if self.byteRate > 0 {
+		state.byte = newTokenBucket(self.byteRate, self.byteBurst)
+	}
+
+	ctx.SetContext(self, state)
+
+	return state
+}
+
+// NewRateLimiter 创建限速处理, msgRate为每秒消息数, byteRate为每秒字节数, 0表示不限制
+// burst为允许的突发量, 0表示与每秒数量相同
+func NewRateLimiter(msgRate float64, msgBurst int, byteRate float64, byteBurst int, action RateLimitAction) EventHandler {
+	return &RateLimiter{
+		msgRate:   msgRate,
+		msgBurst:  msgBurst,
+		byteRate:  byteRate,
+		byteBurst: byteBurst,
+		action:    action,
+	}
+}
+
+// 清理空闲令牌桶的间隔
+const ipRateLimitPruneInterval = time.Minute
+
+// 按IP限制新建连接的速度
+type ipRateLimiter struct {
+	rate  float64
+	burst int
+
+	bucketByIP map[string]*tokenBucket
+	lastPrune  time.Time
+	guard      sync.Mutex
+}
+
+func (self *ipRateLimiter) allow(addr net.Addr) bool {
+	ip := addrIP(addr)
+
+	self.guard.Lock()
+
+	now := time.Now()
+
+	if now.Sub(self.lastPrune) > ipRateLimitPruneInterval {
+		for key, bucket := range self.bucketByIP {
+			if bucket.idle(now) {
+				delete(self.bucketByIP, key)
+			}
+		}
+
+		self.lastPrune = now
+	}
+
+	bucket, ok := self.bucketByIP[ip]
+	if !ok {
+		bucket = newTokenBucket(self.rate, self.burst)
+		self.bucketByIP[ip] = bucket
+	}
+
+	self.guard.Unlock()
+
+	return bucket.take(1) == 0
+}
+
+func newIPRateLimiter(rate float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		rate:       rate,
+		burst:      burst,
+		bucketByIP: make(map[string]*tokenBucket),
+		lastPrune:  time.Now(),
+	}
+}
+
+// 取地址中的IP部分
+func addrIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		return v.IP.String()
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
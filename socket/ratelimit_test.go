@@ -0,0 +1,103 @@
+package socket
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	bucket := newTokenBucket(10, 3)
+
+	// 初始为满桶
+	for i := 0; i < 3; i++ {
+		if wait := bucket.take(1); wait != 0 {
+			t.Fatalf("take %d: wait %s on full bucket", i, wait)
+		}
+	}
+
+	wait := bucket.take(1)
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Fatalf("empty bucket wait %s, want (0, 100ms]", wait)
+	}
+
+	// 经过半秒补充5个令牌, 但不超过容量
+	bucket.last = bucket.last.Add(-500 * time.Millisecond)
+
+	if !bucket.idle(time.Now()) {
+		t.Fatal("bucket not full after refill")
+	}
+
+	if bucket.tokens != bucket.burst {
+		t.Fatalf("tokens %v exceed burst %v", bucket.tokens, bucket.burst)
+	}
+
+	// 超过容量的请求在满桶时通过
+	if wait := bucket.take(10); wait != 0 {
+		t.Fatalf("oversized take wait %s on full bucket", wait)
+	}
+
+	if bucket.idle(time.Now()) {
+		t.Fatal("bucket idle after take")
+	}
+}
+
+func TestTokenBucketDefaultBurst(t *testing.T) {
+	tests := []struct {
+		rate  float64
+		burst int
+		want  float64
+	}{
+		{10, 0, 10},
+		{0.5, 0, 1},
+		{10, 20, 20},
+	}
+
+	for _, tc := range tests {
+		if bucket := newTokenBucket(tc.rate, tc.burst); bucket.burst != tc.want {
+			t.Errorf("rate %v burst %d: got burst %v, want %v", tc.rate, tc.burst, bucket.burst, tc.want)
+		}
+	}
+}
+
+func TestIPRateLimiter(t *testing.T) {
+	limiter := newIPRateLimiter(1, 2)
+
+	a := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+	b := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 1000}
+
+	// 同一IP的不同端口共享令牌桶
+	if !limiter.allow(a) || !limiter.allow(&net.TCPAddr{IP: a.IP, Port: 2000}) {
+		t.Fatal("burst not allowed")
+	}
+
+	if limiter.allow(a) {
+		t.Fatal("connection over limit allowed")
+	}
+
+	if !limiter.allow(b) {
+		t.Fatal("other ip limited")
+	}
+}
+
+func TestRateLimitDrop(t *testing.T) {
+	a, b := newPipeSessions(NewAcceptor())
+	defer a.conn.Close()
+	defer b.conn.Close()
+
+	limiter := NewRateLimiter(1, 1, 0, 0, RateLimit_Drop)
+
+	ev := NewEvent(Event_Recv, b)
+	limiter.Call(ev)
+
+	if ev.Result() != Result_OK {
+		t.Fatalf("first message: got %s, want %s", ev.Result(), Result_OK)
+	}
+
+	ev = NewEvent(Event_Recv, b)
+	limiter.Call(ev)
+
+	if ev.Result() != Result_StopPropagation {
+		t.Fatalf("limited message: got %s, want %s", ev.Result(), Result_StopPropagation)
+	}
+}
@@ -0,0 +1,72 @@
+package socket
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicPolicy 处理器panic时的处理策略
+type PanicPolicy int32
+
+const (
+	Panic_Crash        PanicPolicy = iota // 不恢复, 进程退出
+	Panic_SkipEvent                       // 恢复并跳过当前事件
+	Panic_CloseSession                    // 恢复并以Result_HandlerPanic关闭会话
+)
+
+func (self PanicPolicy) String() string {
+	switch self {
+	case Panic_Crash:
+		return "crash"
+	case Panic_SkipEvent:
+		return "skipevent"
+	case Panic_CloseSession:
+		return "closesession"
+	}
+
+	return "unknown"
+}
+
+// HandlerPanicError 恢复的panic, 作为断开原因中的错误
+type HandlerPanicError struct {
+	Handler string
+	Value   interface{}
+}
+
+func (self *HandlerPanicError) Error() string {
+	return fmt.Sprintf("handler %s panic: %v", self.Handler, self.Value)
+}
+
+// 按策略调用fn, 恢复panic时记录日志, 返回panic的错误, 没有panic时返回nil
+// h为发生panic的处理器, 用于日志
+func callProtected(policy PanicPolicy, h EventHandler, ev *Event, fn func()) (perr *HandlerPanicError) {
+	if policy == Panic_Crash {
+		fn()
+		return nil
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			perr = &HandlerPanicError{
+				Handler: HandlerString(h),
+				Value:   v,
+			}
+
+			fmt.Printf("%s, %s\n%s\n", perr.Error(), eventString(ev), debug.Stack())
+
+			// 关闭会话, 由调用者结束处理
+			if policy == Panic_CloseSession && ev.Ses != nil {
+				ev.Ses.CloseWithReason(Result_HandlerPanic, perr)
+			}
+		}
+	}()
+
+	fn()
+
+	return nil
+}
+
+func eventString(ev *Event) string {
+	return fmt.Sprintf("event: %s peer: %s sesid: %d msgid: %d size: %d",
+		ev.Type, ev.PeerName(), ev.SessionID(), ev.MsgID, ev.MsgSize())
+}
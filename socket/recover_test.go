@@ -0,0 +1,159 @@
+package socket
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 调用时panic的处理器
+func newPanicHandler(name string, trace *[]string) EventHandler {
+	if trace == nil {
+		trace = new([]string)
+	}
+
+	return &traceHandler{name: name, trace: trace, fn: func(ev *Event) {
+		panic("boom")
+	}}
+}
+
+func TestPanicPolicy(t *testing.T) {
+	tests := []struct {
+		policy PanicPolicy
+		result Result
+		closed bool
+	}{
+		{Panic_SkipEvent, Result_SkipEvent, false},
+		{Panic_CloseSession, Result_HandlerPanic, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			var trace []string
+
+			chain := NewHandlerChain(
+				newTraceHandler("a", &trace),
+				newPanicHandler("bad", &trace),
+				newTraceHandler("c", &trace),
+			)
+
+			ses := newIdleSession()
+
+			ev := NewEvent(Event_Recv, ses)
+			chain.callWithPolicy(ev, tc.policy)
+
+			if ev.Result() != tc.result {
+				t.Fatalf("got %s, want %s", ev.Result(), tc.result)
+			}
+
+			// 之后的处理器不再调用
+			if called := strings.Join(trace, ","); called != "a,bad" {
+				t.Fatalf("called %s, want a,bad", called)
+			}
+
+			perr, ok := ev.Err().(*HandlerPanicError)
+			if !ok || perr.Handler != "bad" || perr.Value != "boom" {
+				t.Fatalf("error %v", ev.Err())
+			}
+
+			if closed := ses.CloseReason().Result == Result_HandlerPanic; closed != tc.closed {
+				t.Fatalf("session close reason %s", ses.CloseReason())
+			}
+
+			ev.Release()
+		})
+	}
+
+	// 默认不恢复
+	expectPanic(t, "crash", func() {
+		NewHandlerChain(newPanicHandler("bad", nil)).Call(NewEvent(Event_Recv, nil))
+	})
+}
+
+func TestPanicPolicyChainOverride(t *testing.T) {
+	chain := NewHandlerChain(newPanicHandler("bad", nil))
+	chain.SetPanicPolicy(Panic_SkipEvent)
+
+	// 处理链的策略优先于会话的策略
+	ses := newIdleSession()
+
+	ev := NewEvent(Event_Recv, ses)
+	chain.callWithPolicy(ev, Panic_CloseSession)
+
+	if ev.Result() != Result_SkipEvent || ses.CloseReason().Result != Result_OK || ev.Err().(*HandlerPanicError).Value != "boom" {
+		t.Fatalf("got %s, session %s", ev.Result(), ses.CloseReason())
+	}
+
+	ev.Release()
+
+	// 不经过会话调用时同样使用处理链的策略
+	ev = NewEvent(Event_Recv, nil)
+	chain.Call(ev)
+
+	if ev.Result() != Result_SkipEvent {
+		t.Fatalf("got %s, want %s", ev.Result(), Result_SkipEvent)
+	}
+
+	ev.Release()
+}
+
+func TestPanicSkipOtherChains(t *testing.T) {
+	var trace []string
+
+	list := HandlerChainList{
+		NewHandlerChain(newPanicHandler("bad", &trace)),
+		NewHandlerChain(newTraceHandler("next chain", &trace)),
+	}
+
+	ev := NewEvent(Event_Recv, nil)
+	list.callWithPolicy(ev, Panic_SkipEvent)
+	ev.Release()
+
+	if called := strings.Join(trace, ","); called != "bad,next chain" {
+		t.Fatalf("called %s, want bad,next chain", called)
+	}
+}
+
+func TestPanicSkipReadChain(t *testing.T) {
+	// 读链中panic的消息被丢弃, 会话继续接收
+	pb := NewAcceptor()
+	pb.(SocketOptions).SetPanicPolicy(Panic_SkipEvent)
+	pb.SetReadWriteChain(func() *HandlerChain {
+		return NewHandlerChain(NewLengthFrameReader(), &traceHandler{name: "bad", trace: new([]string), fn: func(ev *Event) {
+			if ev.Type == Event_Recv && string(ev.Data) == "boom" {
+				panic("boom")
+			}
+		}})
+	}, func() *HandlerChain {
+		return NewHandlerChain()
+	})
+
+	rb := &sessionRecorder{recv: make(chan string, 10), closed: make(chan CloseReason, 1)}
+	pb.AddChainRecv(NewHandlerChain(rb))
+
+	ca, cb := net.Pipe()
+	a, b := newSession(ca, newFramePeer()), newSession(cb, pb)
+
+	a.run()
+	b.run()
+
+	a.Send([]byte("boom"))
+	a.Send([]byte("ok"))
+
+	select {
+	case data := <-rb.recv:
+		if data != "ok" {
+			t.Fatalf("received %q, want ok", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message after panic")
+	}
+
+	if reason := b.CloseReason(); reason.Result != Result_OK {
+		t.Fatalf("session closed: %s", reason)
+	}
+
+	a.Close()
+	recvReason(t, rb.closed)
+}
@@ -0,0 +1,259 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// 修改后需要重建处理链的配置项
+var chainConfigFields = map[string]bool{
+	"framing": true,
+	"codec":   true,
+	"read":    true,
+	"write":   true,
+	"send":    true,
+	"recv":    true,
+}
+
+// 修改后需要重启Peer才能生效的配置项
+var restartConfigFields = map[string]bool{
+	"type":    true,
+	"address": true,
+}
+
+// 一项配置修改
+type configChange struct {
+	Field    string // json名
+	Old, New string
+}
+
+func (self configChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", self.Field, self.Old, self.New)
+}
+
+// 逐项比较两个配置, 值使用JSON格式表示
+func diffPeerConfig(a, b *PeerConfig) (ret []configChange) {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+
+	for index := 0; index < va.NumField(); index++ {
+		fa, fb := va.Field(index).Interface(), vb.Field(index).Interface()
+
+		if reflect.DeepEqual(fa, fb) {
+			continue
+		}
+
+		ret = append(ret, configChange{
+			Field: configFieldName(va.Type().Field(index)),
+			Old:   configValueString(fa),
+			New:   configValueString(fb),
+		})
+	}
+
+	return
+}
+
+func configFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+func configValueString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(data)
+}
+
+// 已加载的Peer
+type reloadPeer struct {
+	cfg          PeerConfig
+	p            Peer
+	recvChainIDs []int64 // 按配置添加的接收处理链, 重建处理链时移除
+}
+
+// ConfigReloader 从配置文件创建Peer, 并在配置文件修改后重新加载
+// 选项修改影响之后创建的会话, 开启SetApplyToExisting后同时应用到已建立的会话
+// 处理链修改时重建发送和接收处理链, 已建立会话的读写链不变
+// 增删Peer或修改type, address需要重启
+type ConfigReloader struct {
+	filename string
+
+	peers      map[string]*reloadPeer // 按PeerConfig.String()
+	peersGuard sync.Mutex
+
+	applyToExisting int32
+}
+
+// SetApplyToExisting 重新加载时是否将选项应用到已建立的会话, 默认不应用
+func (self *ConfigReloader) SetApplyToExisting(enable bool) {
+	var v int32
+	if enable {
+		v = 1
+	}
+
+	atomic.StoreInt32(&self.applyToExisting, v)
+}
+
+// Load 读取配置文件并创建所有Peer, 不启动
+func (self *ConfigReloader) Load() ([]Peer, error) {
+	cfg, err := LoadConfig(self.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make(map[string]*reloadPeer)
+
+	var list []Peer
+
+	for index := range cfg.Peers {
+		pc := cfg.Peers[index]
+
+		if _, ok := peers[pc.String()]; ok {
+			return nil, fmt.Errorf("peer %s: duplicate peer", &pc)
+		}
+
+		p, recvChainIDs, err := pc.newPeer()
+		if err != nil {
+			return nil, err
+		}
+
+		peers[pc.String()] = &reloadPeer{cfg: pc, p: p, recvChainIDs: recvChainIDs}
+
+		list = append(list, p)
+	}
+
+	self.peersGuard.Lock()
+	self.peers = peers
+	self.peersGuard.Unlock()
+
+	return list, nil
+}
+
+// Reload 重新读取配置文件, 输出每项修改并应用到对应的Peer
+// 配置文件有错误时返回错误, 不做任何修改
+func (self *ConfigReloader) Reload() error {
+	cfg, err := LoadConfig(self.filename)
+	if err != nil {
+		return err
+	}
+
+	self.peersGuard.Lock()
+	defer self.peersGuard.Unlock()
+
+	found := make(map[string]bool)
+
+	for index := range cfg.Peers {
+		pc := cfg.Peers[index]
+
+		found[pc.String()] = true
+
+		rp, ok := self.peers[pc.String()]
+		if !ok {
+			fmt.Printf("reload peer %s: added, restart required\n", &pc)
+			continue
+		}
+
+		if err := self.reloadPeer(rp, &pc); err != nil {
+			return fmt.Errorf("peer %s: %s", &pc, err.Error())
+		}
+	}
+
+	for name := range self.peers {
+		if !found[name] {
+			fmt.Printf("reload peer %s: removed, restart required\n", name)
+		}
+	}
+
+	return nil
+}
+
+func (self *ConfigReloader) reloadPeer(rp *reloadPeer, pc *PeerConfig) error {
+	changes := diffPeerConfig(&rp.cfg, pc)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var chainChanged bool
+
+	for _, c := range changes {
+		if restartConfigFields[c.Field] {
+			fmt.Printf("reload peer %s: %s, restart required\n", pc, c)
+			continue
+		}
+
+		fmt.Printf("reload peer %s: %s\n", pc, c)
+
+		if chainConfigFields[c.Field] {
+			chainChanged = true
+		}
+	}
+
+	if err := pc.ApplyOptions(rp.p); err != nil {
+		return err
+	}
+
+	if chainChanged {
+		recvChainIDs, err := pc.applyChains(rp.p, rp.recvChainIDs)
+		if err != nil {
+			return err
+		}
+
+		rp.recvChainIDs = recvChainIDs
+	}
+
+	if atomic.LoadInt32(&self.applyToExisting) != 0 {
+		rp.p.VisitSession(func(ses Session) bool {
+			if s, ok := ses.(interface {
+				applyOptions()
+			}); ok {
+				s.applyOptions()
+			}
+
+			return true
+		})
+	}
+
+	// 需要重启的项保持原值, 重启前每次重新加载都会提示
+	newCfg := *pc
+	newCfg.Type, newCfg.Address = rp.cfg.Type, rp.cfg.Address
+	rp.cfg = newCfg
+
+	return nil
+}
+
+// WatchSignal 收到信号时重新加载, 默认为SIGHUP
+func (self *ConfigReloader) WatchSignal(sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+
+	go func() {
+		for range c {
+			if err := self.Reload(); err != nil {
+				fmt.Println("reload:", err.Error())
+			}
+		}
+	}()
+}
+
+func NewConfigReloader(filename string) *ConfigReloader {
+	return &ConfigReloader{
+		filename: filename,
+	}
+}
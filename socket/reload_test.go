@@ -0,0 +1,207 @@
+package socket
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 测试用的处理器, params中的name作为处理器名字
+func init() {
+	RegisterHandlerFactory("test_trace", func(params json.RawMessage) (EventHandler, error) {
+		var p struct {
+			Name string `json:"name"`
+		}
+
+		if err := parseHandlerParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return newTraceHandler(p.Name, new([]string)), nil
+	})
+}
+
+// 接收处理链中的处理器名字, 每条链以逗号分隔, 链之间以|分隔
+func recvChainNames(p Peer) string {
+	var chains []string
+
+	for _, chain := range p.ChainListRecv() {
+		var names []string
+		for _, h := range chain.handlers() {
+			names = append(names, HandlerName(h))
+		}
+
+		chains = append(chains, strings.Join(names, ","))
+	}
+
+	return strings.Join(chains, "|")
+}
+
+func writeConfig(t *testing.T, filename string, peers ...string) {
+	t.Helper()
+
+	data := `{"peers": [` + strings.Join(peers, ",") + `]}`
+
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffPeerConfig(t *testing.T) {
+	a := PeerConfig{Type: "acceptor", Address: ":1", MaxPacketSize: 100}
+
+	b := a
+	b.MaxPacketSize = 200
+	b.Recv = []ChainConfig{{Handlers: []HandlerConfig{{Name: "test_trace"}}}}
+
+	changes := diffPeerConfig(&a, &b)
+
+	var list []string
+	for _, c := range changes {
+		list = append(list, c.String())
+	}
+
+	want := `max_packet_size: 100 -> 200,recv: null -> [{"priority":0,"handlers":[{"name":"test_trace"}]}]`
+	if got := strings.Join(list, ","); got != want {
+		t.Fatalf("changes %s, want %s", got, want)
+	}
+
+	if changes := diffPeerConfig(&a, &a); len(changes) != 0 {
+		t.Fatalf("same config changes %v", changes)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+
+	writeConfig(t, filename, `{"type": "acceptor", "name": "gate", "address": ":1", "max_packet_size": 100,
+		"recv": [{"handlers": [{"name": "test_trace", "params": {"name": "old"}}]}]}`)
+
+	reloader := NewConfigReloader(filename)
+
+	peers, err := reloader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := peers[0]
+
+	// 代码中添加的处理链不受重新加载影响
+	p.AddChainRecvWithPriority(NewHandlerChain(newTraceHandler("manual", new([]string))), -1)
+
+	if names := recvChainNames(p); names != "manual|old" {
+		t.Fatalf("recv chains %s", names)
+	}
+
+	writeConfig(t, filename, `{"type": "acceptor", "name": "gate", "address": ":2", "max_packet_size": 200,
+		"recv": [{"handlers": [{"name": "test_trace", "params": {"name": "new"}}]}, {"priority": -2, "handlers": [{"name": "test_trace", "params": {"name": "low"}}]}]}`)
+
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := p.(SocketOptions).MaxPacketSize(); size != 200 {
+		t.Fatalf("max packet size %d, want 200", size)
+	}
+
+	if names := recvChainNames(p); names != "low|manual|new" {
+		t.Fatalf("reloaded recv chains %s", names)
+	}
+
+	// 地址需要重启才能生效
+	if p.Address() != ":1" {
+		t.Fatalf("address changed to %s", p.Address())
+	}
+
+	// 有错误的配置不做任何修改
+	writeConfig(t, filename, `{"type": "acceptor", "name": "gate", "address": ":1", "max_packet_size": 300,
+		"recv": [{"handlers": [{"name": "not_registered"}]}]}`)
+
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("reload with unknown handler succeeded")
+	}
+
+	if size := p.(SocketOptions).MaxPacketSize(); size != 200 || recvChainNames(p) != "low|manual|new" {
+		t.Fatalf("failed reload modified peer: %d %s", size, recvChainNames(p))
+	}
+}
+
+func TestReplaceChainRecvAtomic(t *testing.T) {
+	p := NewAcceptor()
+
+	mgr := p.(interface {
+		replaceChainRecv(removeIDs []int64, add []recvChainEntry) []int64
+	})
+
+	newEntries := func() []recvChainEntry {
+		return []recvChainEntry{
+			{chain: NewHandlerChain(newTraceHandler("second", new([]string))), priority: 1},
+			{chain: NewHandlerChain(newTraceHandler("first", new([]string))), priority: 0},
+		}
+	}
+
+	ids := mgr.replaceChainRecv(nil, newEntries())
+
+	var (
+		done    int32
+		partial string
+		wg      sync.WaitGroup
+	)
+
+	// 替换过程中不会看到只完成一部分的列表
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer atomic.StoreInt32(&done, 1)
+
+		for i := 0; i < 1000; i++ {
+			if names := recvChainNames(p); names != "first|second" {
+				partial = names
+				return
+			}
+		}
+	}()
+
+	for atomic.LoadInt32(&done) == 0 {
+		ids = mgr.replaceChainRecv(ids, newEntries())
+	}
+
+	wg.Wait()
+
+	if partial != "" {
+		t.Fatalf("saw recv chains %q during replace", partial)
+	}
+
+	for _, id := range ids {
+		if !p.ChainRecvExists(id) {
+			t.Fatalf("chain %d not found", id)
+		}
+	}
+}
+
+func TestConnectionRateLimitKept(t *testing.T) {
+	acceptor := NewAcceptor().(*socketAcceptor)
+
+	acceptor.SetConnectionRateLimit(10, 5)
+	limiter := acceptor.connRateLimit
+
+	// 重新加载时限速不变, 保留每个IP的令牌桶
+	acceptor.SetConnectionRateLimit(10, 5)
+	if acceptor.connRateLimit != limiter {
+		t.Fatal("limiter replaced with same rate")
+	}
+
+	acceptor.SetConnectionRateLimit(20, 5)
+	if acceptor.connRateLimit == limiter {
+		t.Fatal("limiter kept after rate changed")
+	}
+
+	acceptor.SetConnectionRateLimit(0, 0)
+	if acceptor.connRateLimit != nil {
+		t.Fatal("limiter kept after disabled")
+	}
+}
@@ -0,0 +1,189 @@
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// CaptureReplayer 将抓包中一个会话收到的封包按原来的时间间隔重新发出, 用于重现客户端问题和回归测试
+// 记录的Data是记录器所在位置的数据, 发送时不经过发送处理链, 只经过写链
+// 因此重放端写链中的处理器需要与录制端读链中记录器之前的处理器对应, 如LengthFrameReader对应LengthFrameWriter
+type CaptureReplayer struct {
+	records []*CaptureRecord
+
+	// 播放速度倍数, 0表示不等待
+	speed float64
+}
+
+// SetSpeed 设置播放速度倍数, 1为原速, 0表示不等待, 尽快发出
+func (self *CaptureReplayer) SetSpeed(speed float64) {
+	self.speed = speed
+}
+
+// Records 需要重放的封包
+func (self *CaptureReplayer) Records() []*CaptureRecord {
+	return self.records
+}
+
+// Drive 将封包发送到会话, 阻塞到全部放入发送队列, 会话断开时返回错误
+func (self *CaptureReplayer) Drive(ses Session) error {
+	var last time.Time
+
+	for index, rec := range self.records {
+
+		if index > 0 && self.speed > 0 {
+			time.Sleep(time.Duration(float64(rec.Time.Sub(last)) / self.speed))
+		}
+
+		last = rec.Time
+
+		if reason := ses.CloseReason(); reason.Result != Result_OK {
+			return fmt.Errorf("session closed after %d/%d records: %s", index, len(self.records), reason)
+		}
+
+		ev := NewEvent(Event_Send, ses)
+		ev.MsgID = rec.MsgID
+		ev.Flags = rec.Flags
+		ev.Data = rec.Data
+		ev.ChainSend = encodedChainSend
+
+		ses.Send(ev)
+	}
+
+	return nil
+}
+
+// ReplayToAddress 使用Connector连接服务器并重放, 发送完成后断开
+// setup用于设置Connector的读写链, 在连接前调用
+func (self *CaptureReplayer) ReplayToAddress(address string, setup func(p Peer)) error {
+	p := NewConnector().(*socketConnector)
+
+	if setup != nil {
+		setup(p)
+	}
+
+	connected := make(chan Session, 1)
+
+	p.AddChainRecv(NewHandlerChain(NewMiddleware("CaptureReplayer", func(ev *Event, next func()) {
+		if ev.Type == Event_Connected {
+			select {
+			case connected <- ev.Ses:
+			default:
+			}
+		}
+
+		next()
+	})))
+
+	p.SetAutoReconnectSec(0)
+	p.Start(address)
+
+	defer p.Stop()
+
+	var ses Session
+
+	// 连接失败时Connector退出
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for ses == nil {
+		select {
+		case ses = <-connected:
+		case <-ticker.C:
+			if !p.IsRunning() {
+				return errors.New("connect failed: " + address)
+			}
+		}
+	}
+
+	return self.Drive(ses)
+}
+
+// ReplayToPeer 不经过网络, 通过内存连接将封包送入p的读链, 由p的处理链按收到客户端连接处理
+// setup用于设置模拟客户端的读写链, 阻塞到p上的会话断开
+func (self *CaptureReplayer) ReplayToPeer(p Peer, setup func(client Peer)) error {
+	client := NewConnector()
+
+	if setup != nil {
+		setup(client)
+	}
+
+	serverConn, clientConn := net.Pipe()
+
+	serverSes := newSession(serverConn, p)
+	clientSes := newSession(clientConn, client)
+
+	closed := make(chan struct{})
+
+	p.(SessionManager).Add(serverSes)
+
+	serverSes.OnClose = func(reason CloseReason) {
+		p.(SessionManager).Remove(serverSes)
+		close(closed)
+	}
+
+	client.(SessionManager).Add(clientSes)
+
+	clientSes.OnClose = func(reason CloseReason) {
+		client.(SessionManager).Remove(clientSes)
+	}
+
+	// 两端的握手需要同时进行
+	go func() {
+		if !serverSes.postSystemEvent(Event_Accepted) {
+			serverConn.Close()
+		}
+
+		serverSes.run()
+	}()
+
+	go func() {
+		if !clientSes.postSystemEvent(Event_Connected) {
+			clientConn.Close()
+		}
+
+		clientSes.run()
+	}()
+
+	err := self.Drive(clientSes)
+
+	clientSes.Close()
+
+	<-closed
+
+	return err
+}
+
+// NewCaptureReplayer 读取抓包文件, 重放sessionID会话收到的封包, sessionID为0时使用第一个会话
+func NewCaptureReplayer(filename string, sessionID int64) (*CaptureReplayer, error) {
+	list, err := LoadCapture(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &CaptureReplayer{
+		speed: 1,
+	}
+
+	for _, rec := range list {
+		if rec.Dir != Capture_In {
+			continue
+		}
+
+		if sessionID == 0 {
+			sessionID = rec.SessionID
+		}
+
+		if rec.SessionID == sessionID {
+			self.records = append(self.records, rec)
+		}
+	}
+
+	if len(self.records) == 0 {
+		return nil, fmt.Errorf("no inbound records for session %d in %s", sessionID, filename)
+	}
+
+	return self, nil
+}
@@ -0,0 +1,217 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Resolver 将服务名解析为当前的地址列表, 地址格式为host:port
+type Resolver interface {
+	Resolve(service string) ([]string, error)
+}
+
+// ResolverFunc 使用函数实现Resolver
+type ResolverFunc func(service string) ([]string, error)
+
+func (self ResolverFunc) Resolve(service string) ([]string, error) {
+	return self(service)
+}
+
+// 固定地址列表
+type staticResolver struct {
+	addrs map[string][]string
+}
+
+func (self *staticResolver) Resolve(service string) ([]string, error) {
+	addrs, ok := self.addrs[service]
+	if !ok {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+
+	return addrs, nil
+}
+
+// NewStaticResolver 固定的服务地址列表
+func NewStaticResolver(addrs map[string][]string) Resolver {
+	return &staticResolver{addrs: addrs}
+}
+
+// 通过DNS SRV记录解析, 服务名为_service._proto.name格式时proto和name为空
+type srvResolver struct {
+	proto string
+	name  string
+}
+
+func (self *srvResolver) Resolve(service string) ([]string, error) {
+	_, list, err := net.LookupSRV(service, self.proto, self.name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(list))
+
+	for _, srv := range list {
+		addrs = append(addrs, net.JoinHostPort(srv.Target, fmt.Sprint(srv.Port)))
+	}
+
+	return addrs, nil
+}
+
+// NewSRVResolver 按DNS SRV记录解析, 查询_service._proto.name
+// proto和name为空时, 服务名需要是完整的SRV记录名
+func NewSRVResolver(proto, name string) Resolver {
+	return &srvResolver{proto: proto, name: name}
+}
+
+// 从JSON文件解析, 文件内容为服务名到地址列表的映射, 文件修改后重新读取
+type fileResolver struct {
+	filename string
+
+	addrs   map[string][]string
+	modTime time.Time
+	guard   sync.Mutex
+}
+
+func (self *fileResolver) Resolve(service string) ([]string, error) {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	info, err := os.Stat(self.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.ModTime().Equal(self.modTime) {
+		data, err := ioutil.ReadFile(self.filename)
+		if err != nil {
+			return nil, err
+		}
+
+		var addrs map[string][]string
+		if err := json.Unmarshal(data, &addrs); err != nil {
+			return nil, err
+		}
+
+		self.addrs = addrs
+		self.modTime = info.ModTime()
+	}
+
+	addrs, ok := self.addrs[service]
+	if !ok {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+
+	return addrs, nil
+}
+
+// NewFileResolver 从JSON文件解析, 如{"game": ["127.0.0.1:8801"]}, 文件修改后自动重新读取
+func NewFileResolver(filename string) Resolver {
+	return &fileResolver{filename: filename}
+}
+
+// 默认解析间隔
+const defaultResolveInterval = 5 * time.Second
+
+// 定时解析服务地址, 地址变化时回调增删的地址
+type resolverWatcher struct {
+	service  string
+	resolver Resolver
+	interval time.Duration
+
+	onChange func(added, removed []string)
+
+	addrs map[string]bool
+
+	closeSignal chan struct{}
+	endSync     sync.WaitGroup
+}
+
+func (self *resolverWatcher) start() {
+	self.closeSignal = make(chan struct{})
+
+	// 首次解析完成后返回, 启动时即建立连接
+	self.resolve()
+
+	self.endSync.Add(1)
+
+	go func() {
+		defer self.endSync.Done()
+
+		ticker := time.NewTicker(self.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				self.resolve()
+			case <-self.closeSignal:
+				return
+			}
+		}
+	}()
+}
+
+func (self *resolverWatcher) stop() {
+	close(self.closeSignal)
+	self.endSync.Wait()
+}
+
+func (self *resolverWatcher) resolve() {
+	list, err := self.resolver.Resolve(self.service)
+
+	// 解析失败时保持原有地址, 避免解析服务故障时断开所有连接
+	if err != nil {
+		fmt.Printf("resolve %s: %s\n", self.service, err.Error())
+		return
+	}
+
+	latest := make(map[string]bool)
+	for _, addr := range list {
+		latest[addr] = true
+	}
+
+	var added, removed []string
+
+	for addr := range latest {
+		if !self.addrs[addr] {
+			added = append(added, addr)
+		}
+	}
+
+	for addr := range self.addrs {
+		if !latest[addr] {
+			removed = append(removed, addr)
+		}
+	}
+
+	self.addrs = latest
+
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	self.onChange(added, removed)
+}
+
+func newResolverWatcher(service string, resolver Resolver, interval time.Duration, onChange func(added, removed []string)) *resolverWatcher {
+	if interval <= 0 {
+		interval = defaultResolveInterval
+	}
+
+	return &resolverWatcher{
+		service:  service,
+		resolver: resolver,
+		interval: interval,
+		onChange: onChange,
+		addrs:    make(map[string]bool),
+	}
+}
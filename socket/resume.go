@@ -0,0 +1,605 @@
+package socket
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 恢复握手: 连接建立后, 客户端发送令牌 + 已收到的最大序号(uint64), 新会话的令牌全为0
+// 服务器回复令牌 + 会话ID(uint64) + 是否恢复(1字节), 小端
+const (
+	resumeTokenSize = 16
+	resumeSeqSize   = 8
+	resumeHelloSize = resumeTokenSize + resumeSeqSize
+	resumeReplySize = resumeTokenSize + 8 + 1
+)
+
+// 握手超时
+const resumeHandshakeTimeout = 10 * time.Second
+
+type resumeToken [resumeTokenSize]byte
+
+// 会话上保存恢复状态的key
+type resumeStateKey struct{}
+
+// 重发的事件在Tag中保存原序号
+type resumeSeq uint64
+
+// 恢复的会话在连接建立事件的Tag中标记
+type resumedTag struct{}
+
+// 已发送未确认的消息, 保存发送处理链编码后的数据
+type resumeMsg struct {
+	seq   uint64
+	msgID uint32
+	flags uint16
+	data  []byte
+}
+
+// 一个逻辑会话的恢复状态, 在重连之间保持
+type resumeState struct {
+	token resumeToken
+	id    int64
+
+	ses *socketSession // 当前的连接
+
+	msgs       []resumeMsg // 未确认的消息, 按序号递增
+	lastSeq    uint64      // 最后分配的序号, 从1开始
+	acked      uint64      // 客户端确认收到的最大序号
+	droppedSeq uint64      // 超过缓冲上限被丢弃的最大序号, 客户端没有收到时无法恢复
+
+	expired bool        // 超过等待时间或不能恢复, 已投递断开事件
+	timer   *time.Timer // 断开后等待恢复
+
+	guard sync.Mutex
+}
+
+// 分配序号并缓冲, 会话已被新连接恢复时同时发到新连接
+func (self *resumeState) store(ev *Event, maxMsgs int) uint64 {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	self.lastSeq++
+
+	msg := resumeMsg{
+		seq:   self.lastSeq,
+		msgID: ev.MsgID,
+		flags: ev.Flags,
+		data:  append([]byte(nil), ev.Data...),
+	}
+
+	// 已不能恢复, 只分配序号
+	if self.expired {
+		return msg.seq
+	}
+
+	self.msgs = append(self.msgs, msg)
+
+	if maxMsgs > 0 && len(self.msgs) > maxMsgs {
+		self.droppedSeq = self.msgs[0].seq
+		self.msgs = self.msgs[1:]
+	}
+
+	// 在锁内放入队列, 保证新连接按序号发送
+	if self.ses != nil && self.ses != ev.Ses {
+		self.ses.sendList.AddForce(newResumeReplay(self.ses, msg))
+	}
+
+	return msg.seq
+}
+
+// 移除已确认的消息, 调用时需要持有锁
+func (self *resumeState) ackLocked(seq uint64) {
+	if seq <= self.acked {
+		return
+	}
+
+	self.acked = seq
+
+	index := 0
+	for index < len(self.msgs) && self.msgs[index].seq <= seq {
+		index++
+	}
+
+	self.msgs = self.msgs[index:]
+}
+
+func (self *resumeState) ack(seq uint64) {
+	self.guard.Lock()
+	self.ackLocked(seq)
+	self.guard.Unlock()
+}
+
+func resumeStateOf(ses Session) *resumeState {
+	state, _ := ses.(interface {
+		Context(key interface{}) interface{}
+	}).Context(resumeStateKey{}).(*resumeState)
+
+	return state
+}
+
+// 按原序号重发的事件, 不再经过发送处理链
+func newResumeReplay(ses *socketSession, msg resumeMsg) *Event {
+	ev := NewEvent(Event_Send, ses)
+	ev.MsgID = msg.msgID
+	ev.Flags = msg.flags
+	copy(ev.AllocData(len(msg.data)), msg.data)
+	ev.Tag = resumeSeq(msg.seq)
+	ev.ChainSend = encodedChainSend
+
+	return ev
+}
+
+// ResumeManager 可恢复会话, 客户端断线后在等待时间内使用令牌重连, 恢复原来的会话ID和Tag, 并重发未确认的消息
+// 读链最后加入NewReader, 写链最前加入NewWriter, 客户端使用ResumeClient, 需要使用LengthFrame封包
+// 等待恢复期间不投递断开事件, 恢复后不投递连接建立事件, 对逻辑来说会话没有断开
+// 等待期间向原会话发送的消息会被缓冲, 恢复后使用原会话ID查找新的会话
+type ResumeManager struct {
+	p Peer
+
+	grace   time.Duration
+	maxMsgs int
+
+	states      map[resumeToken]*resumeState
+	statesGuard sync.Mutex
+
+	onResume func(ses Session, replayed int)
+
+	resumedCount int64
+}
+
+// SetOnResume 会话恢复后调用, replayed为重发的消息数量
+func (self *ResumeManager) SetOnResume(callback func(ses Session, replayed int)) {
+	self.onResume = callback
+}
+
+// ResumedCount 恢复的会话次数
+func (self *ResumeManager) ResumedCount() int64 {
+	return atomic.LoadInt64(&self.resumedCount)
+}
+
+// NewReader 连接建立时进行恢复握手, 放在读链最后
+func (self *ResumeManager) NewReader() EventHandler {
+	return &resumeReader{mgr: self}
+}
+
+// NewWriter 为发送的消息分配序号并缓冲到确认为止, 放在写链最前
+func (self *ResumeManager) NewWriter() EventHandler {
+	return &resumeWriter{mgr: self}
+}
+
+// 接收处理链, 处理确认, 并隐藏恢复过程中的连接建立和断开事件
+func (self *ResumeManager) Call(ev *Event) {
+	state := resumeStateOf(ev.Ses)
+	if state == nil {
+		return
+	}
+
+	switch ev.Type {
+	case Event_Accepted:
+		if _, ok := ev.Tag.(resumedTag); ok {
+			ev.SetResult(Result_StopPropagation)
+		}
+
+	case Event_Recv:
+		if ev.Flags&FrameFlag_ResumeAck != 0 {
+			if len(ev.Data) >= resumeSeqSize {
+				state.ack(binary.LittleEndian.Uint64(ev.Data))
+			}
+
+			ev.SetResult(Result_StopPropagation)
+		}
+
+	case Event_Closed:
+		if !self.onClosed(state, ev) {
+			ev.SetResult(Result_StopPropagation)
+		}
+	}
+}
+
+// 网络原因断开时等待恢复, 返回是否投递断开事件
+func (self *ResumeManager) onClosed(state *resumeState, ev *Event) bool {
+	ses := ev.Ses.(*socketSession)
+	reason, _ := ev.Msg.(CloseReason)
+
+	state.guard.Lock()
+
+	// 已被新连接恢复
+	if state.ses != ses {
+		state.guard.Unlock()
+		return false
+	}
+
+	// 等待超时后再次投递的断开事件
+	if state.expired {
+		state.guard.Unlock()
+		return true
+	}
+
+	if self.grace > 0 && (reason.Result == Result_SocketError || reason.Result == Result_SocketTimeout) {
+		state.timer = time.AfterFunc(self.grace, func() {
+			self.expire(state, ses, reason)
+		})
+
+		state.guard.Unlock()
+		return false
+	}
+
+	state.expired = true
+	state.msgs = nil
+	state.guard.Unlock()
+
+	self.removeState(state)
+
+	return true
+}
+
+// 等待超时, 投递断开事件
+func (self *ResumeManager) expire(state *resumeState, ses *socketSession, reason CloseReason) {
+	state.guard.Lock()
+
+	if state.ses != ses || state.expired {
+		state.guard.Unlock()
+		return
+	}
+
+	state.expired = true
+	state.msgs = nil
+	state.guard.Unlock()
+
+	self.removeState(state)
+
+	// 与会话断开时相同, 按会话的panic策略投递
+	ses.postClosed(reason)
+}
+
+func (self *ResumeManager) removeState(state *resumeState) {
+	self.statesGuard.Lock()
+
+	if self.states[state.token] == state {
+		delete(self.states, state.token)
+	}
+
+	self.statesGuard.Unlock()
+}
+
+func (self *ResumeManager) handshake(ev *Event) error {
+	ses := ev.Ses.(*socketSession)
+
+	ses.conn.SetDeadline(time.Now().Add(resumeHandshakeTimeout))
+	defer ses.conn.SetDeadline(time.Time{})
+
+	hello := make([]byte, resumeHelloSize)
+	if _, err := io.ReadFull(ses.conn, hello); err != nil {
+		return err
+	}
+
+	var token resumeToken
+	copy(token[:], hello)
+
+	state, replayed := self.resume(ses, token, binary.LittleEndian.Uint64(hello[resumeTokenSize:]))
+
+	resumed := state != nil
+
+	if !resumed {
+		var err error
+		if state, err = self.newState(ses); err != nil {
+			return err
+		}
+	}
+
+	ses.SetContext(resumeStateKey{}, state)
+	ses.SetContext(detachedSendKey{}, func(ev *Event) {
+		self.sendDetached(state, ev)
+	})
+
+	reply := make([]byte, resumeReplySize)
+	copy(reply, state.token[:])
+	binary.LittleEndian.PutUint64(reply[resumeTokenSize:], uint64(state.id))
+
+	if resumed {
+		reply[resumeReplySize-1] = 1
+	}
+
+	if err := writeFull(ses.conn, reply); err != nil {
+		return err
+	}
+
+	if resumed {
+		ev.Tag = resumedTag{}
+
+		atomic.AddInt64(&self.resumedCount, 1)
+
+		if self.onResume != nil {
+			self.onResume(ses, replayed)
+		}
+	}
+
+	return nil
+}
+
+func (self *ResumeManager) newState(ses *socketSession) (*resumeState, error) {
+	state := &resumeState{
+		id:  ses.ID(),
+		ses: ses,
+	}
+
+	if _, err := rand.Read(state.token[:]); err != nil {
+		return nil, err
+	}
+
+	self.statesGuard.Lock()
+	self.states[state.token] = state
+	self.statesGuard.Unlock()
+
+	return state, nil
+}
+
+// 按令牌找到会话并转移到新连接, 不能恢复时返回nil
+func (self *ResumeManager) resume(ses *socketSession, token resumeToken, lastRecv uint64) (*resumeState, int) {
+	if token == (resumeToken{}) {
+		return nil, 0
+	}
+
+	self.statesGuard.Lock()
+	state := self.states[token]
+	self.statesGuard.Unlock()
+
+	if state == nil {
+		return nil, 0
+	}
+
+	state.guard.Lock()
+	defer state.guard.Unlock()
+
+	// 客户端收到的序号需要在缓冲范围内
+	if state.expired || lastRecv < state.acked || lastRecv < state.droppedSeq || lastRecv > state.lastSeq {
+		return nil, 0
+	}
+
+	if state.timer != nil {
+		state.timer.Stop()
+		state.timer = nil
+	}
+
+	state.ackLocked(lastRecv)
+
+	old := state.ses
+	state.ses = ses
+
+	// 使用原会话ID, 会话管理器不支持时使用新ID
+	if !self.p.(interface {
+		reassignSession(ses Session, id int64) bool
+	}).reassignSession(ses, state.id) {
+		state.id = ses.ID()
+	}
+
+	ses.SetTag(old.Tag())
+
+	for _, msg := range state.msgs {
+		ses.sendList.AddForce(newResumeReplay(ses, msg))
+	}
+
+	// 原连接还没有发现断开
+	old.Close()
+
+	return state, len(state.msgs)
+}
+
+// 会话断开后发送的消息, 编码后缓冲, 恢复后重发
+func (self *ResumeManager) sendDetached(state *resumeState, ev *Event) {
+	// 重发的消息已在缓冲中
+	if _, ok := ev.Tag.(resumeSeq); !ok {
+		if ev.ChainSend != nil {
+			ev.ChainSend.Call(ev)
+		}
+
+		if ev.Result() == Result_OK {
+			state.store(ev, self.maxMsgs)
+		}
+	}
+
+	ev.Release()
+}
+
+// NewResumeManager 为Acceptor开启会话恢复, 断线后等待grace时间, 最多缓冲maxMsgs个未确认的消息, 0表示不限制
+func NewResumeManager(p Peer, grace time.Duration, maxMsgs int) *ResumeManager {
+	self := &ResumeManager{
+		p:       p,
+		grace:   grace,
+		maxMsgs: maxMsgs,
+		states:  make(map[resumeToken]*resumeState),
+	}
+
+	// 在所有接收处理链之前处理
+	p.AddChainRecvWithPriority(NewHandlerChain(self), math.MinInt32)
+
+	return self
+}
+
+type resumeReader struct {
+	mgr *ResumeManager
+}
+
+func (self *resumeReader) Call(ev *Event) {
+	if ev.Type != Event_Accepted {
+		return
+	}
+
+	if err := self.mgr.handshake(ev); err != nil {
+		ev.SetError(err)
+	}
+}
+
+type resumeWriter struct {
+	mgr   *ResumeManager
+	state *resumeState
+}
+
+func (self *resumeWriter) Call(ev *Event) {
+	if self.state == nil {
+		self.state = resumeStateOf(ev.Ses)
+
+		// 读链中没有完成握手
+		if self.state == nil {
+			ev.SetResult(Result_CodecError)
+			return
+		}
+	}
+
+	seq, ok := ev.Tag.(resumeSeq)
+	if !ok {
+		seq = resumeSeq(self.state.store(ev, self.mgr.maxMsgs))
+	}
+
+	ev.transformData(resumeSeqSize+len(ev.Data), func(dst, src []byte) {
+		binary.LittleEndian.PutUint64(dst, uint64(seq))
+		copy(dst[resumeSeqSize:], src)
+	})
+}
+
+// ResumeClient 可恢复会话的客户端, 在Connector的重连之间保存令牌和收到的序号
+// 读链最后加入NewReader, 服务器使用ResumeManager
+type ResumeClient struct {
+	token    resumeToken
+	id       int64
+	lastRecv uint64
+	unacked  int
+	resumed  bool
+	guard    sync.Mutex
+
+	ackEvery int
+}
+
+// SessionID 服务器上的会话ID, 恢复后不变
+func (self *ResumeClient) SessionID() int64 {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	return self.id
+}
+
+// Resumed 最近一次连接是否恢复了原来的会话
+func (self *ResumeClient) Resumed() bool {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	return self.resumed
+}
+
+// NewReader 连接建立时进行恢复握手, 之后检查收到消息的序号并确认, 放在读链最后
+func (self *ResumeClient) NewReader() EventHandler {
+	return &resumeClientReader{client: self}
+}
+
+func (self *ResumeClient) handshake(ses Session) error {
+	conn := ses.RawConn().(interface {
+		io.ReadWriter
+		SetDeadline(t time.Time) error
+	})
+
+	conn.SetDeadline(time.Now().Add(resumeHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	self.guard.Lock()
+	hello := make([]byte, resumeHelloSize)
+	copy(hello, self.token[:])
+	binary.LittleEndian.PutUint64(hello[resumeTokenSize:], self.lastRecv)
+	self.guard.Unlock()
+
+	if err := writeFull(conn, hello); err != nil {
+		return err
+	}
+
+	reply := make([]byte, resumeReplySize)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	self.guard.Lock()
+	copy(self.token[:], reply)
+	self.id = int64(binary.LittleEndian.Uint64(reply[resumeTokenSize:]))
+	self.resumed = reply[resumeReplySize-1] != 0
+	self.unacked = 0
+
+	// 新会话的序号从头开始
+	if !self.resumed {
+		self.lastRecv = 0
+	}
+
+	self.guard.Unlock()
+
+	return nil
+}
+
+// 检查序号, 返回需要确认的序号, 不需要时返回0
+func (self *ResumeClient) recv(seq uint64) (ack uint64, ok bool) {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	if seq != self.lastRecv+1 {
+		return 0, false
+	}
+
+	self.lastRecv = seq
+	self.unacked++
+
+	if self.unacked >= self.ackEvery {
+		self.unacked = 0
+		ack = seq
+	}
+
+	return ack, true
+}
+
+// NewResumeClient 创建可恢复会话的客户端, 每收到ackEvery个消息确认一次
+func NewResumeClient(ackEvery int) *ResumeClient {
+	if ackEvery <= 0 {
+		ackEvery = 1
+	}
+
+	return &ResumeClient{
+		ackEvery: ackEvery,
+	}
+}
+
+type resumeClientReader struct {
+	client *ResumeClient
+}
+
+func (self *resumeClientReader) Call(ev *Event) {
+	switch ev.Type {
+	case Event_Connected:
+		if err := self.client.handshake(ev.Ses); err != nil {
+			ev.SetError(err)
+		}
+
+	case Event_Recv:
+		if len(ev.Data) < resumeSeqSize {
+			ev.SetResult(Result_PackageCrack)
+			return
+		}
+
+		ack, ok := self.client.recv(binary.LittleEndian.Uint64(ev.Data))
+		if !ok {
+			ev.SetResult(Result_PackageCrack)
+			return
+		}
+
+		ev.Data = ev.Data[resumeSeqSize:]
+
+		if ack != 0 {
+			ackEv := NewEvent(Event_Send, ev.Ses)
+			ackEv.Flags = FrameFlag_ResumeAck
+			binary.LittleEndian.PutUint64(ackEv.AllocData(resumeSeqSize), ack)
+			ackEv.ChainSend = encodedChainSend
+
+			ev.Ses.Send(ackEv)
+		}
+	}
+}
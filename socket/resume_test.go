@@ -0,0 +1,270 @@
+package socket
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// 在管道两端同时进行客户端和服务器的恢复握手, 返回服务器连接建立事件
+func resumeHandshake(t *testing.T, mgr *ResumeManager, client *ResumeClient, server, clientSes *socketSession) *Event {
+	t.Helper()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- client.handshake(clientSes)
+	}()
+
+	ev := NewEvent(Event_Accepted, server)
+	mgr.NewReader().Call(ev)
+
+	if ev.Result() != Result_OK {
+		t.Fatalf("server handshake: %s %v", ev.Result(), ev.err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+
+	return ev
+}
+
+// 经过写处理器发送, 返回带序号的数据
+func resumeSend(t *testing.T, writer EventHandler, ses *socketSession, msgID uint32, data string) []byte {
+	t.Helper()
+
+	ev := NewEvent(Event_Send, ses)
+	ev.MsgID = msgID
+	copy(ev.AllocData(len(data)), data)
+
+	writer.Call(ev)
+
+	if ev.Result() != Result_OK {
+		t.Fatalf("write msgid %d: %s", msgID, ev.Result())
+	}
+
+	encoded := append([]byte(nil), ev.Data...)
+	ev.Release()
+
+	return encoded
+}
+
+// 客户端读处理器处理收到的数据, 返回去掉序号后的数据
+func resumeRecv(t *testing.T, client *ResumeClient, ses *socketSession, encoded []byte) string {
+	t.Helper()
+
+	ev := NewEvent(Event_Recv, ses)
+	copy(ev.AllocData(len(encoded)), encoded)
+
+	client.NewReader().Call(ev)
+
+	if ev.Result() != Result_OK {
+		t.Fatalf("client recv: %s", ev.Result())
+	}
+
+	data := string(ev.Data)
+	ev.Release()
+
+	return data
+}
+
+func TestResumeSession(t *testing.T) {
+	p := NewAcceptor()
+
+	var replayed int
+	mgr := NewResumeManager(p, time.Minute, 0)
+	mgr.SetOnResume(func(ses Session, n int) {
+		replayed = n
+	})
+
+	client := NewResumeClient(2)
+
+	server, clientSes := newPipeSessions(p)
+	defer server.conn.Close()
+	defer clientSes.conn.Close()
+
+	// 新会话
+	if ev := resumeHandshake(t, mgr, client, server, clientSes); ev.Tag != nil {
+		t.Fatal("new session marked resumed")
+	}
+
+	if client.Resumed() {
+		t.Fatal("client reports resumed on new session")
+	}
+
+	state := resumeStateOf(server)
+	if state == nil {
+		t.Fatal("resume state not set on session")
+	}
+
+	writer := mgr.NewWriter()
+
+	var encoded [][]byte
+	for index, data := range []string{"a", "b", "c"} {
+		encoded = append(encoded, resumeSend(t, writer, server, uint32(index+1), data))
+
+		if seq := binary.LittleEndian.Uint64(encoded[index]); seq != uint64(index+1) {
+			t.Fatalf("msg %s: seq %d, want %d", data, seq, index+1)
+		}
+	}
+
+	// 客户端收到前两个, 每两个确认一次
+	for index, want := range []string{"a", "b"} {
+		if data := resumeRecv(t, client, clientSes, encoded[index]); data != want {
+			t.Fatalf("recv %q, want %q", data, want)
+		}
+	}
+
+	// 序号不连续时视为封包破损
+	ev := NewEvent(Event_Recv, clientSes)
+	ev.Data = encoded[0]
+	client.NewReader().Call(ev)
+
+	if ev.Result() != Result_PackageCrack {
+		t.Fatalf("duplicate seq: got %s, want %s", ev.Result(), Result_PackageCrack)
+	}
+
+	// 确认经发送队列发出, 由服务器的接收处理链处理
+	acks, _ := clientSes.sendList.Pick()
+	if len(acks) != 1 || acks[0].Flags != FrameFlag_ResumeAck {
+		t.Fatalf("got %d ack events, want 1", len(acks))
+	}
+
+	ack := NewEvent(Event_Recv, server)
+	ack.Flags = acks[0].Flags
+	ack.Data = acks[0].Data
+	mgr.Call(ack)
+
+	if ack.Result() != Result_StopPropagation {
+		t.Fatalf("ack delivered to logic: %s", ack.Result())
+	}
+
+	if len(state.msgs) != 1 || state.msgs[0].seq != 3 {
+		t.Fatalf("unacked msgs %v, want seq 3 only", state.msgs)
+	}
+
+	// 断开后发送的消息缓冲到恢复
+	server.sendList.markClosed()
+	server.Send([]byte("d"))
+
+	// 使用令牌在新连接上恢复
+	server2, clientSes2 := newPipeSessions(p)
+	defer server2.conn.Close()
+	defer clientSes2.conn.Close()
+
+	if ev := resumeHandshake(t, mgr, client, server2, clientSes2); ev.Tag != (resumedTag{}) {
+		t.Fatal("resumed session not marked")
+	}
+
+	if !client.Resumed() || client.SessionID() != state.id {
+		t.Fatalf("client resumed %v id %d, want id %d", client.Resumed(), client.SessionID(), state.id)
+	}
+
+	if replayed != 2 || mgr.ResumedCount() != 1 {
+		t.Fatalf("replayed %d resumed %d, want 2 and 1", replayed, mgr.ResumedCount())
+	}
+
+	// 未确认的消息按原序号重发, 不再分配序号
+	replay, _ := server2.sendList.Pick()
+	if len(replay) != 2 {
+		t.Fatalf("got %d replayed events, want 2", len(replay))
+	}
+
+	writer = mgr.NewWriter()
+
+	for index, want := range []string{"c", "d"} {
+		ev := replay[index]
+
+		if string(ev.Data) != want {
+			t.Fatalf("replayed %q, want %q", ev.Data, want)
+		}
+
+		writer.Call(ev)
+
+		if seq := binary.LittleEndian.Uint64(ev.Data); seq != uint64(index+3) {
+			t.Fatalf("replayed %s with seq %d, want %d", want, seq, index+3)
+		}
+
+		ev.Release()
+	}
+
+	if state.lastSeq != 4 {
+		t.Fatalf("last seq %d after replay, want 4", state.lastSeq)
+	}
+}
+
+func TestResumeRejected(t *testing.T) {
+	p := NewAcceptor()
+	mgr := NewResumeManager(p, time.Minute, 1)
+
+	client := NewResumeClient(1)
+
+	server, clientSes := newPipeSessions(p)
+	defer server.conn.Close()
+	defer clientSes.conn.Close()
+
+	resumeHandshake(t, mgr, client, server, clientSes)
+
+	writer := mgr.NewWriter()
+	resumeSend(t, writer, server, 1, "a")
+	resumeSend(t, writer, server, 2, "b")
+
+	// 客户端没有收到的消息已超出缓冲上限, 不能恢复, 作为新会话
+	server2, clientSes2 := newPipeSessions(p)
+	defer server2.conn.Close()
+	defer clientSes2.conn.Close()
+
+	if ev := resumeHandshake(t, mgr, client, server2, clientSes2); ev.Tag != nil {
+		t.Fatal("session resumed after losing unacked messages")
+	}
+
+	if client.Resumed() || mgr.ResumedCount() != 0 {
+		t.Fatal("client reports resumed")
+	}
+
+	if resumeStateOf(server2) == resumeStateOf(server) {
+		t.Fatal("new session shares old resume state")
+	}
+}
+
+func TestResumeExpirePanicPolicy(t *testing.T) {
+	p := NewAcceptor()
+	p.(SocketOptions).SetPanicPolicy(Panic_SkipEvent)
+
+	mgr := NewResumeManager(p, 10*time.Millisecond, 0)
+
+	// 等待超时后投递的断开事件同样按会话的panic策略处理, 不能使进程退出
+	closed := make(chan CloseReason, 1)
+	p.AddChainRecv(NewHandlerChain(&traceHandler{name: "closed", trace: new([]string), fn: func(ev *Event) {
+		if ev.Type == Event_Closed {
+			closed <- ev.Msg.(CloseReason)
+			panic("closed handler")
+		}
+	}}))
+
+	server, clientSes := newPipeSessions(p)
+	defer server.conn.Close()
+	defer clientSes.conn.Close()
+
+	resumeHandshake(t, mgr, NewResumeClient(0), server, clientSes).Release()
+
+	count := EventCount(Event_Closed)
+
+	server.postClosed(CloseReason{Result: Result_SocketError})
+
+	select {
+	case <-closed:
+		t.Fatal("closed event delivered before grace time")
+	default:
+	}
+
+	if reason := recvReason(t, closed); reason.Result != Result_SocketError {
+		t.Fatalf("expired reason %s, want %s", reason, Result_SocketError)
+	}
+
+	// 会话断开和超时后各投递一次
+	waitFor(t, "closed event counted", func() bool {
+		return EventCount(Event_Closed) >= count+2
+	})
+}
@@ -0,0 +1,189 @@
+package socket
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 服务连接器创建的Connector默认的重连间隔
+const defaultServiceReconnectSec = 3
+
+// ServiceConnector 按服务名连接一组后端, 每个地址一个Connector
+// 定时通过Resolver解析地址, 新地址建立连接, 移除的地址断开连接
+// 地址不变时不会重新创建Connector, 连接失败或断开后由Connector自动重连, 默认间隔3秒
+// setup中调用SetAutoReconnectSec(0)关闭重连时, 断开的地址直到从解析结果中移除再加入才会重新连接
+type ServiceConnector struct {
+	service  string
+	resolver Resolver
+	interval time.Duration
+
+	reconnectSec int
+
+	// 每个地址的Connector数量, 连接池使用多个
+	connsPerAddr int
+
+	// 新建Connector后, 启动前调用, 用于设置处理链和选项
+	setup func(p Peer)
+
+	// 地址或连接变化后调用, 持有connectorsGuard, 用于连接池更新快照
+	onUpdate func(byAddr map[string][]Peer)
+
+	watcher *resolverWatcher
+
+	connectors      map[string][]Peer // 按地址
+	connectorsGuard sync.RWMutex
+
+	stopSync sync.WaitGroup
+}
+
+// SetResolveInterval 设置解析间隔, 默认5秒, 在Start前调用
+func (self *ServiceConnector) SetResolveInterval(d time.Duration) {
+	self.interval = d
+}
+
+// SetAutoReconnectSec 设置新建Connector的重连间隔, 默认3秒, 在Start前调用
+func (self *ServiceConnector) SetAutoReconnectSec(sec int) {
+	self.reconnectSec = sec
+}
+
+// Start 解析服务地址并连接, 之后定时解析
+func (self *ServiceConnector) Start() {
+	self.watcher = newResolverWatcher(self.service, self.resolver, self.interval, self.onChange)
+	self.watcher.start()
+}
+
+// Stop 停止解析并断开所有连接
+func (self *ServiceConnector) Stop() {
+	if self.watcher != nil {
+		self.watcher.stop()
+		self.watcher = nil
+	}
+
+	self.connectorsGuard.Lock()
+
+	for addr, list := range self.connectors {
+		self.stopConnectors(list)
+		delete(self.connectors, addr)
+	}
+
+	self.notifyUpdate()
+
+	self.connectorsGuard.Unlock()
+
+	self.stopSync.Wait()
+}
+
+func (self *ServiceConnector) onChange(added, removed []string) {
+	self.connectorsGuard.Lock()
+	defer self.connectorsGuard.Unlock()
+
+	for _, addr := range removed {
+		fmt.Printf("service %s: remove %s\n", self.service, addr)
+
+		if list, ok := self.connectors[addr]; ok {
+			self.stopConnectors(list)
+			delete(self.connectors, addr)
+		}
+	}
+
+	for _, addr := range added {
+		fmt.Printf("service %s: add %s\n", self.service, addr)
+
+		list := make([]Peer, self.connsPerAddr)
+
+		for index := range list {
+			p := NewConnector()
+			p.SetName(self.service)
+			p.(Connector).SetAutoReconnectSec(self.reconnectSec)
+
+			if self.setup != nil {
+				self.setup(p)
+			}
+
+			p.Start(addr)
+
+			list[index] = p
+		}
+
+		self.connectors[addr] = list
+	}
+
+	self.notifyUpdate()
+}
+
+// 调用时需要持有connectorsGuard
+func (self *ServiceConnector) notifyUpdate() {
+	if self.onUpdate == nil {
+		return
+	}
+
+	byAddr := make(map[string][]Peer, len(self.connectors))
+	for addr, list := range self.connectors {
+		byAddr[addr] = list
+	}
+
+	self.onUpdate(byAddr)
+}
+
+// 停止需要等待连接线程结束, 不阻塞解析
+func (self *ServiceConnector) stopConnectors(list []Peer) {
+	for _, p := range list {
+		self.stopSync.Add(1)
+
+		go func(p Peer) {
+			p.Stop()
+			self.stopSync.Done()
+		}(p)
+	}
+}
+
+// Connectors 当前所有地址的Connector, 按地址排序
+func (self *ServiceConnector) Connectors() []Peer {
+	self.connectorsGuard.RLock()
+	defer self.connectorsGuard.RUnlock()
+
+	addrs := make([]string, 0, len(self.connectors))
+	for addr := range self.connectors {
+		addrs = append(addrs, addr)
+	}
+
+	sort.Strings(addrs)
+
+	var list []Peer
+	for _, addr := range addrs {
+		list = append(list, self.connectors[addr]...)
+	}
+
+	return list
+}
+
+// Sessions 当前已连接的会话
+func (self *ServiceConnector) Sessions() []Session {
+	var list []Session
+
+	for _, p := range self.Connectors() {
+		if ses := p.(Connector).DefaultSession(); ses != nil {
+			list = append(list, ses)
+		}
+	}
+
+	return list
+}
+
+// NewServiceConnector 创建服务连接器, setup在每个Connector启动前调用, 可以为nil
+func NewServiceConnector(service string, resolver Resolver, setup func(p Peer)) *ServiceConnector {
+	return newServiceConnector(service, resolver, 1, setup)
+}
+
+func newServiceConnector(service string, resolver Resolver, connsPerAddr int, setup func(p Peer)) *ServiceConnector {
+	return &ServiceConnector{
+		service:      service,
+		resolver:     resolver,
+		reconnectSec: defaultServiceReconnectSec,
+		connsPerAddr: connsPerAddr,
+		setup:        setup,
+		connectors:   make(map[string][]Peer),
+	}
+}
@@ -0,0 +1,209 @@
+package socket
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录连接的监听端, 连接在accepted中按顺序给出
+type testBackend struct {
+	ln       net.Listener
+	accepted chan net.Conn
+}
+
+func newTestBackend(t *testing.T) *testBackend {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self := &testBackend{ln: ln, accepted: make(chan net.Conn, 10)}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			self.accepted <- conn
+		}
+	}()
+
+	t.Cleanup(func() { ln.Close() })
+
+	return self
+}
+
+func (self *testBackend) addr() string {
+	return self.ln.Addr().String()
+}
+
+func (self *testBackend) accept(t *testing.T, timeout time.Duration) net.Conn {
+	t.Helper()
+
+	select {
+	case conn := <-self.accepted:
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	case <-time.After(timeout):
+		t.Fatalf("no connection to %s", self.addr())
+		return nil
+	}
+}
+
+// 可修改的解析结果
+type testResolver struct {
+	addrs []string
+	err   error
+	guard sync.Mutex
+}
+
+func (self *testResolver) set(err error, addrs ...string) {
+	self.guard.Lock()
+	self.addrs, self.err = addrs, err
+	self.guard.Unlock()
+}
+
+func (self *testResolver) Resolve(service string) ([]string, error) {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	return self.addrs, self.err
+}
+
+func newTestServiceConnector(resolver Resolver) *ServiceConnector {
+	sc := NewServiceConnector("test", resolver, func(p Peer) {
+		p.SetReadWriteChain(func() *HandlerChain {
+			return NewHandlerChain(NewLengthFrameReader())
+		}, func() *HandlerChain {
+			return NewHandlerChain(NewLengthFrameWriter())
+		})
+	})
+
+	sc.SetResolveInterval(10 * time.Millisecond)
+
+	return sc
+}
+
+// Connector的地址在连接线程中设置, 从解析结果中取
+func connectorAddrs(sc *ServiceConnector) []string {
+	sc.connectorsGuard.RLock()
+	defer sc.connectorsGuard.RUnlock()
+
+	var list []string
+	for addr := range sc.connectors {
+		list = append(list, addr)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestServiceConnectorResolve(t *testing.T) {
+	backendA, backendB := newTestBackend(t), newTestBackend(t)
+
+	// 按地址排序, 与Connectors的顺序一致
+	if backendA.addr() > backendB.addr() {
+		backendA, backendB = backendB, backendA
+	}
+
+	resolver := &testResolver{}
+	resolver.set(nil, backendA.addr())
+
+	sc := newTestServiceConnector(resolver)
+
+	// 首次解析在Start返回前完成
+	sc.Start()
+	defer sc.Stop()
+
+	if got := connectorAddrs(sc); !sameAddrs(got, []string{backendA.addr()}) {
+		t.Fatalf("connectors %v after start", got)
+	}
+
+	connA := backendA.accept(t, time.Second)
+	first := sc.Connectors()[0]
+
+	waitFor(t, "session", func() bool { return len(sc.Sessions()) == 1 })
+
+	// 新地址建立连接, 原有地址的Connector保持不变
+	resolver.set(nil, backendB.addr(), backendA.addr())
+
+	waitFor(t, "added address", func() bool {
+		return sameAddrs(connectorAddrs(sc), []string{backendA.addr(), backendB.addr()})
+	})
+
+	backendB.accept(t, time.Second)
+
+	if sc.Connectors()[0] != first {
+		t.Fatal("connector recreated for unchanged address")
+	}
+
+	// 解析失败时保持原有连接
+	resolver.set(net.UnknownNetworkError("test"))
+	time.Sleep(50 * time.Millisecond)
+
+	if got := connectorAddrs(sc); len(got) != 2 {
+		t.Fatalf("connectors %v after resolve error", got)
+	}
+
+	// 移除的地址断开连接
+	resolver.set(nil, backendB.addr())
+
+	waitFor(t, "removed address", func() bool {
+		return sameAddrs(connectorAddrs(sc), []string{backendB.addr()})
+	})
+
+	connA.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := connA.Read(make([]byte, 1)); err == nil {
+		t.Fatal("removed address still connected")
+	}
+
+	waitFor(t, "first connector stopped", func() bool { return !first.(*socketConnector).IsRunning() })
+
+	sc.Stop()
+
+	if got := connectorAddrs(sc); len(got) != 0 {
+		t.Fatalf("connectors %v after stop", got)
+	}
+}
+
+func TestServiceConnectorReconnect(t *testing.T) {
+	backend := newTestBackend(t)
+
+	resolver := &testResolver{}
+	resolver.set(nil, backend.addr())
+
+	sc := newTestServiceConnector(resolver)
+	sc.SetAutoReconnectSec(1)
+
+	sc.Start()
+	defer sc.Stop()
+
+	// 地址没有变化, 断开后由Connector重连
+	backend.accept(t, time.Second).Close()
+
+	backend.accept(t, 3*time.Second)
+
+	waitFor(t, "reconnected session", func() bool { return len(sc.Sessions()) == 1 })
+}
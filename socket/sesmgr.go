@@ -72,7 +72,29 @@ func (self *SessionManagerImplement) Add(ses Session) {
 
 func (self *SessionManagerImplement) Remove(ses Session) {
 	self.sesMapGuard.Lock()
-	delete(self.sesMap, ses.ID())
+
+	// ID可能已被恢复的会话使用
+	if self.sesMap[ses.ID()] == ses {
+		delete(self.sesMap, ses.ID())
+	}
+
+	self.sesMapGuard.Unlock()
+}
+
+// 会话改用指定的ID, 原来使用该ID的会话不再能通过ID找到, 用于恢复会话
+func (self *SessionManagerImplement) reassign(ses Session, id int64) {
+	self.sesMapGuard.Lock()
+
+	if self.sesMap[ses.ID()] == ses {
+		delete(self.sesMap, ses.ID())
+	}
+
+	ses.(interface {
+		SetID(int64)
+	}).SetID(id)
+
+	self.sesMap[id] = ses
+
 	self.sesMapGuard.Unlock()
 }
 
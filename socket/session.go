@@ -1,9 +1,11 @@
 package socket
 
 import (
+	"bufio"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +20,15 @@ type Session interface {
 	// 断开
 	Close()
 
+	// 带原因断开, 原因通过Event_Closed和CloseReason传递
+	CloseWithReason(r Result, err error)
+
+	// 发送一个消息后断开, 消息在socket关闭前写出
+	Kick(msg interface{}, r Result)
+
+	// 断开原因, 未断开时Result为Result_OK
+	CloseReason() CloseReason
+
 	// 标示ID
 	ID() int64
 
@@ -32,10 +43,36 @@ type Session interface {
 
 	// 取原始连接net.Conn
 	RawConn() interface{}
+
+	// 发送队列中等待的事件数量
+	SendQueueLen() int
+
+	// 发送队列中等待的数据字节数
+	SendQueueSize() int
+
+	// 连接地址, 使用PROXY协议时为真实客户端地址
+	RemoteAddr() net.Addr
+	LocalAddr() net.Addr
+
+	// 连接建立时间
+	ConnectedAt() time.Time
+
+	// 最后收到消息的时间, 没有收到过消息时为零值
+	LastRecvAt() time.Time
+
+	// 收发的字节数和消息数
+	BytesIn() int64
+	BytesOut() int64
+	MsgsIn() int64
+	MsgsOut() int64
 }
 
 type socketSession struct {
-	OnClose func() // 关闭函数回调
+	OnClose func(reason CloseReason) // 关闭函数回调
+
+	// 第一个断开原因
+	closeReason      CloseReason
+	closeReasonGuard sync.Mutex
 
 	id int64
 
@@ -49,10 +86,23 @@ type socketSession struct {
 
 	conn net.Conn
 
+	// 合并写时的写缓冲, 为nil表示直接写conn
+	writer *bufio.Writer
+
+	// 读写数据源, 合并写时写入writer
+	stream io.ReadWriter
+
+	// 连接统计
+	sessionStat
+
 	tag interface{}
 
 	tagGuard sync.RWMutex
 
+	// 处理器在会话上保存的数据, 如读写链共享的状态
+	context      map[interface{}]interface{}
+	contextGuard sync.RWMutex
+
 	readChain *HandlerChain
 
 	writeChain *HandlerChain
@@ -73,12 +123,30 @@ func (self *socketSession) SetTag(tag interface{}) {
 	self.tagGuard.Unlock()
 }
 
+// Context 取处理器保存在会话上的数据
+func (self *socketSession) Context(key interface{}) interface{} {
+	self.contextGuard.RLock()
+	defer self.contextGuard.RUnlock()
+	return self.context[key]
+}
+
+// SetContext 处理器在会话上保存数据, 同一会话的读写链可以通过它共享状态
+func (self *socketSession) SetContext(key, value interface{}) {
+	self.contextGuard.Lock()
+	if self.context == nil {
+		self.context = make(map[interface{}]interface{})
+	}
+	self.context[key] = value
+	self.contextGuard.Unlock()
+}
+
 func (self *socketSession) ID() int64 {
-	return self.id
+	return atomic.LoadInt64(&self.id)
 }
 
+// SetID 恢复会话时会在运行中修改
 func (self *socketSession) SetID(id int64) {
-	self.id = id
+	atomic.StoreInt64(&self.id, id)
 }
 
 func (self *socketSession) FromPeer() Peer {
@@ -86,30 +154,135 @@ func (self *socketSession) FromPeer() Peer {
 }
 
 func (self *socketSession) DataSource() io.ReadWriter {
-	return self.conn
+	return self.stream
 }
 
 func (self *socketSession) Close() {
+	self.CloseWithReason(Result_RequestClose, nil)
+}
+
+func (self *socketSession) CloseWithReason(r Result, err error) {
+	self.setCloseReason(r, err)
+
 	self.sendList.Add(nil)
 }
 
+func (self *socketSession) Kick(msg interface{}, r Result) {
+	self.setCloseReason(r, nil)
+
+	// 踢出消息不受发送队列限制, 写出后发送线程退出并关闭socket
+	self.sendList.AddForce(self.newSendEvent(msg))
+	self.sendList.Add(nil)
+}
+
+func (self *socketSession) CloseReason() CloseReason {
+	self.closeReasonGuard.Lock()
+	defer self.closeReasonGuard.Unlock()
+
+	return self.closeReason
+}
+
+// 只记录第一个断开原因, 之后的错误通常由第一个原因引起
+func (self *socketSession) setCloseReason(r Result, err error) {
+	self.closeReasonGuard.Lock()
+
+	if self.closeReason.Result == Result_OK {
+		self.closeReason = CloseReason{Result: r, Err: err}
+	}
+
+	self.closeReasonGuard.Unlock()
+}
+
 func (self *socketSession) Send(data interface{}) {
+	ev := self.newSendEvent(data)
+
+	switch self.sendList.Add(ev) {
+	case Result_SendQueueFull:
 
+		// 超限策略为关闭时, 断开会话
+		if policy, _ := self.p.(SocketOptions).SendQueueOverflow(); policy == Overflow_Close {
+			self.CloseWithReason(Result_SendQueueFull, nil)
+		}
+
+	case Result_RequestClose:
+		self.sendDetached(ev)
+	}
+}
+
+// 会话上保存断开后发送处理的key, 值为func(ev *Event)
+type detachedSendKey struct{}
+
+// 会话断开后发送的事件, 交给处理器设置的断开后发送处理, 如可恢复会话的缓冲, 没有时丢弃
+func (self *socketSession) sendDetached(ev *Event) {
+	if fn, ok := self.Context(detachedSendKey{}).(func(ev *Event)); ok {
+		fn(ev)
+		return
+	}
+
+	ev.Release()
+}
+
+func (self *socketSession) newSendEvent(data interface{}) *Event {
+	var ev *Event
+
+	switch v := data.(type) {
+	case *Event:
+		ev = v
+	case []byte:
+		ev = NewEvent(Event_Send, self)
+		ev.Data = v
+	default:
+		ev = NewEvent(Event_Send, self)
+		ev.Msg = data
+	}
+
+	if ev.ChainSend == nil {
+		ev.ChainSend = self.p.ChainSend()
+	}
+
+	return ev
+}
+
+func (self *socketSession) SendQueueLen() int {
+	return self.sendList.Len()
+}
+
+func (self *socketSession) SendQueueSize() int {
+	return self.sendList.Size()
 }
 
 func (self *socketSession) recvThread() {
+	opt := self.FromPeer().(SocketOptions)
+
 	for {
 		ev := NewEvent(Event_Recv, self)
 
-		read, _ := self.FromPeer().(SocketOptions).SocketDeadline()
+		read, _ := opt.SocketDeadline()
 
 		if read != 0 {
 			self.conn.SetReadDeadline(time.Now().Add(read))
 		}
 
-		self.readChain.Call(ev)
+		policy := opt.PanicPolicy()
+
+		self.readChain.callWithPolicy(ev, policy)
+
+		switch ev.Result() {
+		case Result_OK:
+		case Result_StopPropagation, Result_SkipEvent:
+			// 读链丢弃的消息, 如超过限速或处理器panic后跳过
+			ev.Release()
+			continue
+		default:
+			self.setCloseReason(ev.Result(), ev.Err())
+			ev.Release()
+			goto onClose
+		}
+
+		self.onRecv()
 
-		if ev.Result() != Result_OK {
+		// 投递到接收处理链, 处理完成后归还缓冲
+		if !self.dispatchRecv(policy, ev) {
 			goto onClose
 		}
 
@@ -120,56 +293,111 @@ func (self *socketSession) recvThread() {
 	}
 
 	if self.needNotifyWrite {
-		self.Close()
+		self.sendList.Add(nil)
 	}
 
 	// 通知接收线程ok
 	self.endSync.Done()
 }
 
+// 投递到接收处理链并归还事件, 处理器panic关闭会话时返回false
+func (self *socketSession) dispatchRecv(policy PanicPolicy, ev *Event) bool {
+	recvList := self.p.ChainListRecv()
+
+	countEvent(ev.Type)
+
+	// 接收日志
+	MsgLog(ev)
+
+	recvList.callWithPolicy(ev, policy)
+
+	ev.Release()
+
+	return self.CloseReason().Result != Result_HandlerPanic
+}
+
 // 发送线程
 func (self *socketSession) sendThread() {
+	opt := self.FromPeer().(SocketOptions)
+
+	_, maxDelay := opt.WriteCoalesce()
+
+	// 写缓冲中最早的数据进入的时间
+	var pendingSince time.Time
+
 	for {
+		var writeList []*Event
+		var willExit bool
+
+		if self.writer != nil && self.writer.Buffered() > 0 {
+
+			// 缓冲中有数据时, 最多等到超过停留时间
+			wait := maxDelay - time.Since(pendingSince)
+
+			var ok bool
+			if wait > 0 {
+				writeList, willExit, ok = self.sendList.PickTimeout(wait)
+			}
+
+			if !ok {
+				if err := self.flush(); err != nil {
+					self.setCloseReason(errToResult(err), err)
+					goto exitsendloop
+				}
+
+				continue
+			}
+
+		} else {
+			writeList, willExit = self.sendList.Pick()
+		}
+
 		// 写超时
-		_, write := self.FromPeer().(SocketOptions).SocketDeadline()
+		_, write := opt.SocketDeadline()
 
 		if write != 0 {
 			self.conn.SetWriteDeadline(time.Now().Add(write))
 		}
 
-		writeList, willExit := self.sendList.Pick()
-
 		// 写队列
 		for _, ev := range writeList {
-			// 发送链处理: encode等操作
-			if ev.ChainSend != nil {
-				ev.ChainSend.Call(ev)
-			}
+			self.writeEvent(opt.PanicPolicy(), ev)
 
-			if ev.Result() != Result_OK {
+			// 处理器panic后跳过的事件不影响之后的发送
+			if r := ev.Result(); r != Result_OK && r != Result_SkipEvent {
 				willExit = true
 			}
 
-			// 发送日志
-			//MsgLog(ev)
+			ev.Release()
+		}
 
-			// 写链处理
-			self.writeChain.Call(ev)
+		if self.writer != nil && self.writer.Buffered() > 0 {
 
-			if ev.Result() != Result_OK {
-				willExit = true
+			// 不限停留时间或将要退出时, 每批事件写出一次
+			if maxDelay == 0 || willExit {
+				if err := self.flush(); err != nil {
+					self.setCloseReason(errToResult(err), err)
+					willExit = true
+				}
+			} else if pendingSince.IsZero() {
+				pendingSince = time.Now()
 			}
 		}
 
-		//if err := self.conn.Flush(); err != nil {
-		//	willExit = true
-		//}
+		if self.writer == nil || self.writer.Buffered() == 0 {
+			pendingSince = time.Time{}
+		}
 
 		if willExit {
 			goto exitsendloop
 		}
 	}
 exitsendloop:
+	// 唤醒阻塞在队列上的发送者, 未发送的事件按断开后发送处理
+	for _, ev := range self.sendList.markClosed() {
+		self.sendDetached(ev)
+	}
+
 	// 不需要读线程再次通知写线程
 	self.needNotifyWrite = false
 
@@ -180,6 +408,76 @@ exitsendloop:
 	self.endSync.Done()
 }
 
+// 处理并写出一个事件
+func (self *socketSession) writeEvent(policy PanicPolicy, ev *Event) {
+	// 发送链处理: encode等操作
+	if ev.ChainSend != nil {
+		ev.ChainSend.callWithPolicy(ev, policy)
+	}
+
+	if ev.Result() != Result_OK {
+		self.onWriteFailed(ev)
+		return
+	}
+
+	// 发送日志
+	MsgLog(ev)
+
+	// 写链处理
+	self.writeChain.callWithPolicy(ev, policy)
+
+	if ev.Result() != Result_OK {
+		self.onWriteFailed(ev)
+		return
+	}
+
+	countEvent(ev.Type)
+
+	self.onSend()
+}
+
+// 跳过的事件直接丢弃, 其他错误作为断开原因
+func (self *socketSession) onWriteFailed(ev *Event) {
+	if ev.Result() != Result_SkipEvent {
+		self.setCloseReason(ev.Result(), ev.Err())
+	}
+}
+
+// 写出缓冲中的数据
+func (self *socketSession) flush() error {
+	_, write := self.FromPeer().(SocketOptions).SocketDeadline()
+
+	if write != 0 {
+		self.conn.SetWriteDeadline(time.Now().Add(write))
+	}
+
+	return self.writer.Flush()
+}
+
+// 投递连接建立等系统事件, 先经过读链(握手等), 再投递到接收处理链
+// 在收发线程启动前调用, 读链处理失败时返回false
+func (self *socketSession) postSystemEvent(t EventType) bool {
+	ev := NewEvent(t, self)
+
+	policy := self.p.(SocketOptions).PanicPolicy()
+
+	// 握手失败或panic后跳过时都不能继续
+	self.readChain.callWithPolicy(ev, policy)
+
+	ok := ev.Result() == Result_OK
+
+	if ok {
+		countEvent(ev.Type)
+		self.p.ChainListRecv().callWithPolicy(ev, policy)
+	} else {
+		self.setCloseReason(ev.Result(), ev.Err())
+	}
+
+	ev.Release()
+
+	return ok
+}
+
 func (self *socketSession) run() {
 	// 布置接收和发送2个任务
 	self.endSync.Add(2)
@@ -188,9 +486,13 @@ func (self *socketSession) run() {
 		// 等待2个任务结束
 		self.endSync.Wait()
 
+		reason := self.CloseReason()
+
+		self.postClosed(reason)
+
 		// 在这里断开session与逻辑的所有关系
 		if self.OnClose != nil {
-			self.OnClose()
+			self.OnClose(reason)
 		}
 	}()
 
@@ -201,6 +503,34 @@ func (self *socketSession) run() {
 	go self.sendThread()
 }
 
+// 通知接收处理链会话已断开, Msg为断开原因
+func (self *socketSession) postClosed(reason CloseReason) {
+	ev := NewEvent(Event_Closed, self)
+	ev.Msg = reason
+	countEvent(ev.Type)
+	self.p.ChainListRecv().callWithPolicy(ev, self.p.(SocketOptions).PanicPolicy())
+	ev.Release()
+}
+
+// 按Peer当前的选项设置发送队列限制
+func (self *socketSession) applyQueueLimit() {
+	if opt, ok := self.p.(SocketOptions); ok {
+		maxLen, maxSize := opt.SendQueueLimit()
+		policy, blockTimeout := opt.SendQueueOverflow()
+		self.sendList.SetLimit(maxLen, maxSize, policy, blockTimeout)
+	}
+}
+
+// 将Peer修改后的选项应用到已建立的会话
+// 读写超时和最大包长每次读写时读取, 合并写缓冲只在会话创建时设置
+func (self *socketSession) applyOptions() {
+	self.p.(interface {
+		Apply(conn net.Conn)
+	}).Apply(self.conn)
+
+	self.applyQueueLimit()
+}
+
 func newSession(conn net.Conn, p Peer) *socketSession {
 	p.(interface {
 		Apply(conn net.Conn)
@@ -210,7 +540,26 @@ func newSession(conn net.Conn, p Peer) *socketSession {
 		conn:            conn,
 		p:               p,
 		needNotifyWrite: true,
-		//sendList:        NewPacketList(),
+		sendList:        NewPacketList(),
+	}
+
+	self.connectedAt = time.Now()
+
+	stream := &sessionStream{
+		stat:   &self.sessionStat,
+		reader: conn,
+		writer: conn,
+	}
+
+	self.stream = stream
+
+	self.applyQueueLimit()
+
+	if opt, ok := p.(SocketOptions); ok {
+		if threshold, _ := opt.WriteCoalesce(); threshold > 0 {
+			self.writer = bufio.NewWriterSize(conn, threshold)
+			stream.writer = self.writer
+		}
 	}
 
 	self.readChain = p.CreateChainRead()
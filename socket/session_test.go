@@ -0,0 +1,320 @@
+package socket
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 通过内存管道连接的两端会话
+func newPipeSessions(p Peer) (a, b *socketSession) {
+	ca, cb := net.Pipe()
+
+	return newSession(ca, p), newSession(cb, p)
+}
+
+// 等待条件成立, 超时后失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newFramePeer() Peer {
+	p := NewAcceptor()
+	p.SetReadWriteChain(func() *HandlerChain {
+		return NewHandlerChain(NewLengthFrameReader())
+	}, func() *HandlerChain {
+		return NewHandlerChain(NewLengthFrameWriter())
+	})
+
+	return p
+}
+
+// 记录每次写入大小的连接
+type recordConn struct {
+	net.Conn
+
+	writes []int
+	guard  sync.Mutex
+}
+
+func (self *recordConn) Write(p []byte) (int, error) {
+	self.guard.Lock()
+	self.writes = append(self.writes, len(p))
+	self.guard.Unlock()
+
+	return self.Conn.Write(p)
+}
+
+func (self *recordConn) Writes() []int {
+	self.guard.Lock()
+	defer self.guard.Unlock()
+
+	return append([]int(nil), self.writes...)
+}
+
+func newCoalescePeer(threshold int, maxDelay time.Duration) Peer {
+	p := NewAcceptor()
+	p.(SocketOptions).SetWriteCoalesce(threshold, maxDelay)
+	p.SetReadWriteChain(func() *HandlerChain {
+		return NewHandlerChain()
+	}, func() *HandlerChain {
+		return NewHandlerChain(NewFixedLengthFrameWriter())
+	})
+
+	return p
+}
+
+func TestWriteCoalesce(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		writes    []int
+	}{
+		{"disabled", 0, []int{10, 10, 10}},
+		{"one batch", 1024, []int{30}},
+		{"threshold", 16, []int{16, 14}},
+	}
+
+	payload := []byte("0123456789")
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newCoalescePeer(tc.threshold, 0)
+
+			server, client := net.Pipe()
+			conn := &recordConn{Conn: server}
+			ses := newSession(conn, p)
+
+			// 在发送线程启动前放入, 一次取出
+			for i := 0; i < 3; i++ {
+				ses.Send(append([]byte(nil), payload...))
+			}
+
+			ses.Close()
+
+			received := make(chan []byte, 1)
+			go func() {
+				data, _ := io.ReadAll(client)
+				received <- data
+			}()
+
+			ses.endSync.Add(1)
+			go ses.sendThread()
+
+			data := <-received
+
+			if !bytes.Equal(data, bytes.Repeat(payload, 3)) {
+				t.Fatalf("received %q", data)
+			}
+
+			writes := conn.Writes()
+			if len(writes) != len(tc.writes) {
+				t.Fatalf("writes %v, want %v", writes, tc.writes)
+			}
+
+			for index := range writes {
+				if writes[index] != tc.writes[index] {
+					t.Fatalf("writes %v, want %v", writes, tc.writes)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteCoalesceMaxDelay(t *testing.T) {
+	const maxDelay = 30 * time.Millisecond
+
+	p := newCoalescePeer(1024, maxDelay)
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := &recordConn{Conn: server}
+	ses := newSession(conn, p)
+
+	ses.Send([]byte("ab"))
+	ses.Send([]byte("cd"))
+
+	begin := time.Now()
+
+	ses.endSync.Add(1)
+	go ses.sendThread()
+
+	// 没有后续事件时, 缓冲中的数据在停留时间后写出
+	data := make([]byte, 4)
+	if _, err := io.ReadFull(client, data); err != nil || string(data) != "abcd" {
+		t.Fatalf("received %q %v", data, err)
+	}
+
+	if elapsed := time.Since(begin); elapsed < maxDelay {
+		t.Fatalf("flushed after %s, before max delay", elapsed)
+	}
+
+	if writes := conn.Writes(); len(writes) != 1 {
+		t.Fatalf("writes %v, want one", writes)
+	}
+
+	ses.Close()
+	io.Copy(io.Discard, client)
+}
+
+func TestSessionStat(t *testing.T) {
+	a, b := newPipeSessions(newFramePeer())
+
+	if a.ConnectedAt().IsZero() || !b.LastRecvAt().IsZero() {
+		t.Fatal("unexpected initial times")
+	}
+
+	if a.RemoteAddr() != a.conn.RemoteAddr() || a.LocalAddr() != a.conn.LocalAddr() {
+		t.Fatal("addresses differ from connection")
+	}
+
+	a.run()
+	b.run()
+
+	a.Send([]byte("hello"))
+	a.Send([]byte("hi"))
+
+	waitFor(t, "messages received", func() bool {
+		return b.MsgsIn() == 2
+	})
+
+	// 封包头 + 包体
+	const size = lengthFrameHeaderSize*2 + 5 + 2
+
+	if a.MsgsOut() != 2 || a.BytesOut() != size {
+		t.Fatalf("sent %d msgs %d bytes, want 2 msgs %d bytes", a.MsgsOut(), a.BytesOut(), size)
+	}
+
+	if b.BytesIn() != size || a.MsgsIn() != 0 || a.BytesIn() != 0 {
+		t.Fatalf("received %d bytes, want %d", b.BytesIn(), size)
+	}
+
+	if b.LastRecvAt().Before(b.ConnectedAt()) {
+		t.Fatal("last recv time not updated")
+	}
+
+	a.Close()
+	a.endSync.Wait()
+	b.endSync.Wait()
+}
+
+// 记录会话收到的消息和断开原因
+type sessionRecorder struct {
+	recv   chan string
+	closed chan CloseReason
+}
+
+func (self *sessionRecorder) Call(ev *Event) {
+	switch ev.Type {
+	case Event_Recv:
+		self.recv <- string(ev.Data)
+	case Event_Closed:
+		self.closed <- ev.Msg.(CloseReason)
+	}
+}
+
+// 两端使用不同的Peer, 分别记录
+func newRecordedPipe() (a, b *socketSession, ra, rb *sessionRecorder, onClose chan CloseReason) {
+	ca, cb := net.Pipe()
+
+	ra = &sessionRecorder{recv: make(chan string, 10), closed: make(chan CloseReason, 1)}
+	rb = &sessionRecorder{recv: make(chan string, 10), closed: make(chan CloseReason, 1)}
+
+	pa, pb := newFramePeer(), newFramePeer()
+	pa.AddChainRecv(NewHandlerChain(ra))
+	pb.AddChainRecv(NewHandlerChain(rb))
+
+	a, b = newSession(ca, pa), newSession(cb, pb)
+
+	onClose = make(chan CloseReason, 1)
+	a.OnClose = func(reason CloseReason) {
+		onClose <- reason
+	}
+
+	a.run()
+	b.run()
+
+	return
+}
+
+func recvReason(t *testing.T, ch chan CloseReason) CloseReason {
+	t.Helper()
+
+	select {
+	case reason := <-ch:
+		return reason
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for close")
+	}
+
+	return CloseReason{}
+}
+
+func TestCloseWithReason(t *testing.T) {
+	a, _, ra, rb, onClose := newRecordedPipe()
+
+	a.CloseWithReason(Result_RateLimited, nil)
+
+	// 第一个原因之后的错误不覆盖
+	a.CloseWithReason(Result_PackageCrack, nil)
+
+	if reason := recvReason(t, ra.closed); reason.Result != Result_RateLimited {
+		t.Fatalf("closed event reason %s, want %s", reason, Result_RateLimited)
+	}
+
+	if reason := recvReason(t, onClose); reason.Result != Result_RateLimited {
+		t.Fatalf("OnClose reason %s, want %s", reason, Result_RateLimited)
+	}
+
+	// 对端读到连接关闭
+	if reason := recvReason(t, rb.closed); reason.Result != Result_SocketError || reason.Err == nil {
+		t.Fatalf("remote reason %s, want %s with error", reason, Result_SocketError)
+	}
+}
+
+func TestKick(t *testing.T) {
+	a, _, _, rb, onClose := newRecordedPipe()
+
+	a.Send([]byte("first"))
+	a.Kick([]byte("bye"), Result_RequestClose)
+
+	// 之后的消息不再发送
+	a.Send([]byte("after kick"))
+
+	for _, want := range []string{"first", "bye"} {
+		select {
+		case data := <-rb.recv:
+			if data != want {
+				t.Fatalf("received %q, want %q", data, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+
+	if reason := recvReason(t, onClose); reason.Result != Result_RequestClose {
+		t.Fatalf("OnClose reason %s, want %s", reason, Result_RequestClose)
+	}
+
+	recvReason(t, rb.closed)
+
+	select {
+	case data := <-rb.recv:
+		t.Fatalf("received %q after kick", data)
+	default:
+	}
+}
@@ -0,0 +1,86 @@
+package socket
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// 会话的连接统计, 计数由收发线程维护
+type sessionStat struct {
+	connectedAt time.Time
+	lastRecvAt  int64 // UnixNano
+
+	bytesIn  int64
+	bytesOut int64
+	msgsIn   int64
+	msgsOut  int64
+}
+
+func (self *sessionStat) ConnectedAt() time.Time {
+	return self.connectedAt
+}
+
+func (self *sessionStat) LastRecvAt() time.Time {
+	v := atomic.LoadInt64(&self.lastRecvAt)
+	if v == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, v)
+}
+
+func (self *sessionStat) BytesIn() int64 {
+	return atomic.LoadInt64(&self.bytesIn)
+}
+
+func (self *sessionStat) BytesOut() int64 {
+	return atomic.LoadInt64(&self.bytesOut)
+}
+
+func (self *sessionStat) MsgsIn() int64 {
+	return atomic.LoadInt64(&self.msgsIn)
+}
+
+func (self *sessionStat) MsgsOut() int64 {
+	return atomic.LoadInt64(&self.msgsOut)
+}
+
+// 接收线程收到一个消息
+func (self *sessionStat) onRecv() {
+	atomic.AddInt64(&self.msgsIn, 1)
+	atomic.StoreInt64(&self.lastRecvAt, time.Now().UnixNano())
+}
+
+// 发送线程写出一个消息
+func (self *sessionStat) onSend() {
+	atomic.AddInt64(&self.msgsOut, 1)
+}
+
+func (self *socketSession) RemoteAddr() net.Addr {
+	return self.conn.RemoteAddr()
+}
+
+func (self *socketSession) LocalAddr() net.Addr {
+	return self.conn.LocalAddr()
+}
+
+// 会话的读写数据源, 统计收发字节数
+type sessionStream struct {
+	stat   *sessionStat
+	reader io.Reader
+	writer io.Writer
+}
+
+func (self *sessionStream) Read(p []byte) (int, error) {
+	n, err := self.reader.Read(p)
+	atomic.AddInt64(&self.stat.bytesIn, int64(n))
+	return n, err
+}
+
+func (self *sessionStream) Write(p []byte) (int, error) {
+	n, err := self.writer.Write(p)
+	atomic.AddInt64(&self.stat.bytesOut, int64(n))
+	return n, err
+}